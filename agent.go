@@ -0,0 +1,74 @@
+package omssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AgentConn : connection to ssh agent
+type AgentConn struct {
+	agent.ExtendedAgent
+	conn net.Conn
+}
+
+// Close : close connection to ssh agent
+func (a *AgentConn) Close() error {
+	return a.conn.Close()
+}
+
+// ConnectAgent : connect to ssh agent listening on socket, SSH_AUTH_SOCK if empty
+func ConnectAgent(socket string) (*AgentConn, error) {
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if socket == "" {
+		return nil, errors.New("no ssh agent: SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connect to ssh agent %s: %v", socket, err)
+	}
+	return &AgentConn{ExtendedAgent: agent.NewClient(conn), conn: conn}, nil
+}
+
+// AddKeyToAgent : add private key to ssh agent, which removes it after lifetime
+func AddKeyToAgent(a agent.Agent, privateKey []byte, comment string, lifetime time.Duration) error {
+	key, err := ssh.ParseRawPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	return a.Add(agent.AddedKey{
+		PrivateKey:   key,
+		Comment:      comment,
+		LifetimeSecs: uint32(lifetime.Seconds()),
+	})
+}
+
+// AgentAuth : authenticate with keys in ssh agent
+func AgentAuth(a agent.Agent) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(a.Signers)
+}
+
+// WithAgentForwarding : forward ssh agent to the remote like ssh -A
+func WithAgentForwarding(a agent.Agent) Option {
+	return func(d *SSHDevice) {
+		d.agent = a
+	}
+}
+
+// forwardAgent : serve agent requests of the remote and request forwarding on the session
+func (d *SSHDevice) forwardAgent() error {
+	if d.agent == nil {
+		return nil
+	}
+	if err := agent.ForwardToAgent(d.client, d.agent); err != nil {
+		return err
+	}
+	return agent.RequestAgentForwarding(d.session)
+}
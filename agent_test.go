@@ -0,0 +1,138 @@
+package omssh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestConnectAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "omssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := l.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if err := agent.ServeAgent(keyring, conn); err != nil {
+					log.Printf("Failed to serve agent (%s)", err)
+				}
+			}()
+		}
+	}()
+
+	a, err := ConnectAgent(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := a.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := AddKeyToAgent(a, []byte(testPrivateKey), "omssh", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("wrong result: \n%v", keys)
+	}
+	if diff := cmp.Diff("omssh", keys[0].Comment); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if _, err := ConnectAgent(filepath.Join(dir, "hoge.sock")); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
+
+func TestAgentForwarding(t *testing.T) {
+	keyring := agent.NewKeyring()
+	if err := AddKeyToAgent(keyring, []byte(testPrivateKey), "omssh", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	for _, testcase := range []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{"forwarded", []Option{WithAgentForwarding(keyring)}, ssh.FingerprintSHA256(signer.PublicKey()) + " omssh\n"},
+		{"not forwarded", nil, ""},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			device := NewDevice("localhost", testPort, append(testcase.opts, WithStdio(nil, &stdout, &stderr))...)
+			sshClientConfig := &ssh.ClientConfig{
+				User:            "testUser",
+				Auth:            []ssh.AuthMethod{AgentAuth(keyring)},
+				HostKeyCallback: ssh.FixedHostKey(signer.PublicKey()),
+			}
+			if err := device.SSHConnect(sshClientConfig); err != nil {
+				t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+			}
+			defer func() {
+				if err := device.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			device.SetupIO()
+
+			err := device.Run("ssh-add -l")
+			if testcase.expected == "" {
+				if err == nil || !strings.Contains(stderr.String(), "authentication agent") {
+					t.Errorf("wrong result: \n%v %s", err, stderr.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, stdout.String()); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
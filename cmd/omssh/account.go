@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/sts"
+
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+	"github.com/kenzo0107/omssh/pkg/utility"
+)
+
+// accountSession : session of an account which ec2 instances are described in
+type accountSession struct {
+	account awsapi.Account
+	sess    *session.Session
+}
+
+// selectProfiles : select a profile in aws credentials, or several profiles if multi
+func selectProfiles(multi bool) ([]string, error) {
+	profiles, err := utility.GetProfiles(getCredentialsPath(runtime.GOOS))
+	if err != nil {
+		return nil, err
+	}
+
+	if multi {
+		return utility.FinderProfiles(profiles)
+	}
+	profile, err := utility.FinderProfile(profiles)
+	if err != nil {
+		return nil, err
+	}
+	return []string{profile}, nil
+}
+
+// profileNames : names of profiles selected in aws credentials, separated by commas
+func profileNames(profilesWithAssumeRole []string) string {
+	names := make([]string, 0, len(profilesWithAssumeRole))
+	for _, p := range profilesWithAssumeRole {
+		names = append(names, strings.Split(p, "|")[0])
+	}
+	return strings.Join(names, ",")
+}
+
+// profileSession : return session of profile in aws credentials and its name, cfgs are merged
+func profileSession(profileWithAssumeRole, region string, cfgs ...*aws.Config) (*session.Session, string) {
+	_p := strings.Split(profileWithAssumeRole, "|")
+
+	if len(_p) > 1 {
+		profile, roleArn, mfaSerial, sourceProfile := awsapi.GetProfileWithAssumeRole(profileWithAssumeRole)
+
+		sourceSess := awsapi.NewSession(sourceProfile, region, cfgs...)
+
+		f := func(o *stscreds.AssumeRoleProvider) {
+			o.Duration = time.Hour
+			o.RoleSessionName = sourceProfile
+			o.SerialNumber = aws.String(mfaSerial)
+			o.TokenProvider = stscreds.StdinTokenProvider
+		}
+
+		creds := stscreds.NewCredentials(sourceSess, roleArn, f)
+
+		config := aws.Config{
+			Region:      aws.String(region),
+			Credentials: creds,
+		}
+
+		for _, cfg := range cfgs {
+			config.MergeIn(cfg)
+		}
+
+		return session.Must(session.NewSessionWithOptions(session.Options{
+			Config:  config,
+			Profile: profile,
+		})), profile
+	}
+
+	profile := _p[0]
+	return awsapi.NewSession(profile, region, cfgs...), profile
+}
+
+// profileSessions : sessions of the accounts of profiles, one by one as mfa codes may be asked.
+// first is the session of the first profile already made, whose mfa code is not asked again.
+// Profiles of an account already added are skipped.
+func profileSessions(first *session.Session, profilesWithAssumeRole []string, region string, cfgs ...*aws.Config) ([]accountSession, error) {
+	var accounts []accountSession
+	seen := map[string]bool{}
+	for n, p := range profilesWithAssumeRole {
+		sess, profile := first, strings.Split(p, "|")[0]
+		if n > 0 {
+			sess, profile = profileSession(p, region, cfgs...)
+		}
+		identity, err := awsapi.NewSTSClient(sts.New(sess)).GetCallerIdentity()
+		if err != nil {
+			return nil, err
+		}
+		if seen[identity.Account] {
+			log.Printf("skip profile %s: account %s is already selected\n", profile, identity.Account)
+			continue
+		}
+		seen[identity.Account] = true
+
+		alias, err := awsapi.NewIAMClient(iam.New(sess)).AccountAlias()
+		if err != nil {
+			// the alias is only shown in the finder
+			log.Printf("account alias of %s: %v\n", profile, err)
+		}
+		if alias == "" {
+			alias = profile
+		}
+		accounts = append(accounts, accountSession{
+			account: awsapi.Account{ID: identity.Account, Alias: alias},
+			sess:    sess,
+		})
+	}
+	return accounts, nil
+}
+
+// organizationSessions : sessions of every active account in the aws organization of sess, assuming role in each account
+// except the account of sess itself
+func organizationSessions(sess *session.Session, role string) ([]accountSession, error) {
+	identity, err := awsapi.NewSTSClient(sts.New(sess)).GetCallerIdentity()
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := awsapi.NewOrganizationsClient(organizations.New(sess)).ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%d accounts in the organization\n", len(accounts))
+
+	sessions := make([]accountSession, 0, len(accounts))
+	for _, a := range accounts {
+		if a.ID == identity.Account {
+			sessions = append(sessions, accountSession{account: a, sess: sess})
+			continue
+		}
+		creds := stscreds.NewCredentials(sess, awsapi.RoleARN(a.ID, role), func(o *stscreds.AssumeRoleProvider) {
+			o.Duration = time.Hour
+			o.RoleSessionName = name
+		})
+		sessions = append(sessions, accountSession{
+			account: a,
+			sess:    sess.Copy(&aws.Config{Credentials: creds}),
+		})
+	}
+	return sessions, nil
+}
+
+// logSkippedAccounts : log errors of accounts skipped in the organization, once for each account
+func logSkippedAccounts(errs []error) {
+	seen := map[string]bool{}
+	for _, err := range errs {
+		if d, ok := err.(*awsapi.DescribeError); ok {
+			if seen[d.Account] {
+				continue
+			}
+			seen[d.Account] = true
+		}
+		log.Printf("skip: %v\n", err)
+	}
+}
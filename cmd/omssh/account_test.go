@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProfileNames(t *testing.T) {
+	profiles := []string{
+		"default",
+		"moge|role_arn = arn:aws:iam::1234567890:role/stsRole|source_profile = hoge",
+	}
+	if diff := cmp.Diff("default,moge", profileNames(profiles)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
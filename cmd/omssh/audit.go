@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/audit"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+// newAuditLogger : logger writing to sinks of --audit-log, nil if there are none
+func newAuditLogger(specs []string, client *http.Client) (*audit.Logger, error) {
+	var sinks []audit.Sink
+	for _, spec := range specs {
+		s, err := audit.ParseSink(spec, client)
+		if err != nil {
+			for _, s := range sinks {
+				_ = s.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return audit.NewLogger(localUser(), sinks...), nil
+}
+
+// localUser : name of the user running omssh
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// auditedEC2InstanceConnect : logs every ssh public key sent with ec2 instance connect
+type auditedEC2InstanceConnect struct {
+	awsapi.EC2InstanceConnectIface
+	audit *audit.Logger
+	// account, region : where the client sends ssh public keys
+	account string
+	region  string
+}
+
+func (a *auditedEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	ok, err := a.EC2InstanceConnectIface.SendSSHPubKey(p)
+	e := audit.Event{
+		Type:       audit.KeyPushed,
+		Region:     a.region,
+		Account:    a.account,
+		InstanceID: aws.StringValue(p.InstanceId),
+		User:       aws.StringValue(p.InstanceOSUser),
+	}
+	switch {
+	case err != nil:
+		e.Type = audit.KeyPushFailed
+		e.Error = err.Error()
+	case !ok:
+		e.Type = audit.KeyPushFailed
+		e.Error = "not sent"
+	}
+	a.audit.Log(e)
+	return ok, err
+}
+
+// auditedDevice : logs port forwardings and the disconnect with how long it was connected and the exit status
+type auditedDevice struct {
+	omssh.Device
+	audit *audit.Logger
+	event audit.Event
+	start time.Time
+
+	mu         sync.Mutex
+	exitStatus *int
+	err        error
+	closed     bool
+}
+
+func newAuditedDevice(device omssh.Device, logger *audit.Logger, event audit.Event) *auditedDevice {
+	return &auditedDevice{Device: device, audit: logger, event: event, start: time.Now()}
+}
+
+func (d *auditedDevice) StartShell() error {
+	err := d.Device.StartShell()
+	d.result(err)
+	return err
+}
+
+func (d *auditedDevice) Run(cmd string) error {
+	err := d.Device.Run(cmd)
+	d.result(err)
+	return err
+}
+
+// result : keep exit status of the shell or command, or the error if it did not exit
+func (d *auditedDevice) result(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := err.(interface{ ExitStatus() int }); ok {
+		d.exitStatus = audit.ExitStatus(e.ExitStatus())
+		return
+	}
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.exitStatus = audit.ExitStatus(0)
+}
+
+func (d *auditedDevice) LocalForward(f omssh.Forward) error {
+	return d.logForward("local", f, d.Device.LocalForward(f))
+}
+
+func (d *auditedDevice) RemoteForward(f omssh.Forward) error {
+	return d.logForward("remote", f, d.Device.RemoteForward(f))
+}
+
+func (d *auditedDevice) DynamicForward(f omssh.Forward) error {
+	return d.logForward("dynamic", f, d.Device.DynamicForward(f))
+}
+
+// forwardOpened : log the port forwarding opened by ~C, which does not go through the audited device
+func (d *auditedDevice) forwardOpened(kind string, f omssh.Forward, err error) {
+	_ = d.logForward(kind, f, err)
+}
+
+func (d *auditedDevice) logForward(kind string, f omssh.Forward, err error) error {
+	e := d.event
+	e.Type = audit.ForwardOpened
+	e.Forward = kind + " " + f.String()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	d.audit.Log(e)
+	return err
+}
+
+func (d *auditedDevice) Close() error {
+	err := d.Device.Close()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return err
+	}
+	d.closed = true
+
+	e := d.event
+	e.Type = audit.Disconnected
+	e.Duration = time.Since(d.start).Seconds()
+	e.ExitStatus = d.exitStatus
+	if d.err != nil {
+		e.Error = d.err.Error()
+	}
+	d.audit.Log(e)
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/audit"
+)
+
+// memorySink : keeps events
+type memorySink struct {
+	events []audit.Event
+}
+
+func (s *memorySink) Write(e audit.Event) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+// types : types of events
+func (s *memorySink) types() []string {
+	var types []string
+	for _, e := range s.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+type fakeEC2InstanceConnect struct {
+	err error
+}
+
+func (f *fakeEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	return f.err == nil, f.err
+}
+
+func TestAuditedEC2InstanceConnect(t *testing.T) {
+	sink := &memorySink{}
+	logger := audit.NewLogger("kenzo", sink)
+	input := ec2instanceconnect.SendSSHPublicKeyInput{
+		InstanceId:     aws.String("i-1234567890"),
+		InstanceOSUser: aws.String("ubuntu"),
+	}
+
+	for _, err := range []error{nil, errors.New("AccessDeniedException")} {
+		a := &auditedEC2InstanceConnect{EC2InstanceConnectIface: &fakeEC2InstanceConnect{err: err}, audit: logger}
+		if _, e := a.SendSSHPubKey(input); e != err {
+			t.Errorf("wrong result: \n%v", e)
+		}
+	}
+
+	if diff := cmp.Diff([]string{audit.KeyPushed, audit.KeyPushFailed}, sink.types()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("AccessDeniedException", sink.events[1].Error); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("ubuntu", sink.events[0].User); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+// fakeDevice : device whose commands succeed
+type fakeDevice struct {
+	omssh.Device
+}
+
+func (d *fakeDevice) Run(cmd string) error {
+	return nil
+}
+
+func (d *fakeDevice) LocalForward(f omssh.Forward) error {
+	return nil
+}
+
+func (d *fakeDevice) Close() error {
+	return nil
+}
+
+func TestAuditedDevice(t *testing.T) {
+	sink := &memorySink{}
+	logger := audit.NewLogger("kenzo", sink)
+	device := newAuditedDevice(&fakeDevice{}, logger, audit.Event{InstanceID: "i-1234567890", User: "ubuntu"})
+
+	if err := device.LocalForward(omssh.Forward{BindAddress: "localhost:8080", DialAddress: "localhost:80"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := device.Run("uptime"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := device.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if diff := cmp.Diff([]string{audit.ForwardOpened, audit.Disconnected}, sink.types()); diff != "" {
+		t.Fatalf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("local localhost:8080 -> localhost:80", sink.events[0].Forward); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff(audit.ExitStatus(0), sink.events[1].ExitStatus); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("i-1234567890", sink.events[1].InstanceID); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestAuditedDeviceForwardOpened(t *testing.T) {
+	sink := &memorySink{}
+	logger := audit.NewLogger("kenzo", sink)
+	device := newAuditedDevice(&fakeDevice{}, logger, audit.Event{InstanceID: "i-1234567890", User: "ubuntu"})
+
+	// ~C -L 8080:localhost:80 in the shell
+	device.forwardOpened("local", omssh.Forward{BindAddress: "localhost:8080", DialAddress: "localhost:80"}, nil)
+	device.forwardOpened("dynamic", omssh.Forward{BindAddress: "localhost:1080"}, errors.New("address already in use"))
+
+	if diff := cmp.Diff([]string{audit.ForwardOpened, audit.ForwardOpened}, sink.types()); diff != "" {
+		t.Fatalf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("local localhost:8080 -> localhost:80", sink.events[0].Forward); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("address already in use", sink.events[1].Error); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/patrickmn/go-cache"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/audit"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+	"github.com/kenzo0107/omssh/pkg/eice"
+	"github.com/kenzo0107/omssh/pkg/filter"
+	"github.com/kenzo0107/omssh/pkg/fleet"
+	"github.com/kenzo0107/omssh/pkg/proxy"
+	"github.com/kenzo0107/omssh/pkg/utility"
+)
+
+// connector : connects to the selected ec2 instances as the selected user
+type connector struct {
+	profile string
+	// targets : aws clients of the accounts and the regions which ec2 instances are described in, by targetKey
+	targets             map[string]*target
+	eicClient           awsapi.EC2InstanceConnectIface
+	user                string
+	port                string
+	publicKey           string
+	signer              ssh.Signer
+	knownHosts          *omssh.KnownHosts
+	consoleFingerprints bool
+
+	// inventory : all running ec2 instances, where bastions are found
+	inventory []awsapi.EC2
+	// bastion : jump host to every ec2 instance, found by tag for private ec2 instances if nil
+	bastion *awsapi.EC2
+
+	// eice : connect through ec2 instance connect endpoints instead of bastions
+	eice      bool
+	tunnelsMu sync.Mutex
+	tunnels   map[string]*eice.Tunnel
+
+	// proxy : upstream proxies of ssh connections
+	proxy *proxy.Environment
+
+	// agent : local ssh agent used for authentication, nil if not connected
+	agent        *omssh.AgentConn
+	forwardAgent bool
+
+	// keepalive : interval of keepalive requests, not sent if 0
+	keepalive         time.Duration
+	keepaliveCountMax int
+
+	// escapeChar : escape character of the shell, disabled if 0
+	escapeChar byte
+
+	// audit : logger of connections, nil if not audited
+	audit *audit.Logger
+}
+
+// target : aws clients of an account in a region, with which ec2 instances there are described and connected
+type target struct {
+	ec2         awsapi.EC2Iface
+	endpoint    eice.EndpointIface
+	credentials *credentials.Credentials
+}
+
+// targetKey : key of the target of the account in the region, the account is empty for the selected profile
+func targetKey(accountID, region string) string {
+	return accountID + "/" + region
+}
+
+// newConnector : select profile, ec2 instances and user
+func newConnector(c *cli.Context) (*connector, []awsapi.EC2, error) {
+	return newConnectorSelecting(c, awsapi.FinderEC2)
+}
+
+// newConnectorSelecting : select profile, ec2 instances with selectEC2s and user
+func newConnectorSelecting(c *cli.Context, selectEC2s func([]awsapi.EC2) ([]awsapi.EC2, error)) (*connector, []awsapi.EC2, error) {
+	f := flagsOf(c)
+	region := f.String("region")
+	regions := awsapi.ParseRegions(region)
+	if len(regions) == 0 {
+		return nil, nil, errors.New("no region")
+	}
+	isUser := f.Bool("user")
+
+	filters, err := ec2Filters(f.StringSlice("filter"), f.StringSlice("tag"))
+	if err != nil {
+		return nil, nil, err
+	}
+	var expression filter.Expression
+	if s := f.String("match"); s != "" {
+		if expression, err = awsapi.ParseEC2Expression(s); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hostKeyMode, err := omssh.ParseHostKeyMode(f.String("strict-host-key-checking"))
+	if err != nil {
+		return nil, nil, err
+	}
+	escapeChar, err := omssh.ParseEscapeChar(f.String("escape-char"))
+	if err != nil {
+		return nil, nil, err
+	}
+	knownHostsPath := f.String("known-hosts")
+	if knownHostsPath == "" {
+		if knownHostsPath, err = omssh.DefaultKnownHostsPath(runtime.GOOS); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	env, err := proxy.FromEnvironment(os.Getenv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionRegion := regions[0]
+	if sessionRegion == awsapi.AllRegions {
+		sessionRegion = defaultRegion
+	}
+	cfg := &aws.Config{HTTPClient: env.HTTPClient()}
+	profiles, err := selectProfiles(f.Bool("profiles"))
+	if err != nil {
+		return nil, nil, err
+	}
+	sess, _ := profileSession(profiles[0], sessionRegion, cfg)
+
+	auditLogger, err := newAuditLogger(f.StringSlice("audit-log"), env.HTTPClient())
+	if err != nil {
+		return nil, nil, err
+	}
+	if auditLogger != nil {
+		var identity *audit.Identity
+		callerIdentity, err := awsapi.NewSTSClient(sts.New(sess)).GetCallerIdentity()
+		if err != nil {
+			// connections are audited without the identity rather than refused
+			log.Printf("audit log: %v\n", err)
+		} else {
+			identity = &audit.Identity{
+				Account: callerIdentity.Account,
+				Arn:     callerIdentity.Arn,
+				UserID:  callerIdentity.UserID,
+			}
+		}
+		auditLogger.SetSession(profileNames(profiles), region, identity)
+		auditLogger.Log(audit.Event{Type: audit.ProfileSelected})
+	}
+
+	var accounts []accountSession
+	switch role := f.String("org-role"); {
+	case role != "":
+		accounts, err = organizationSessions(sess, role)
+	case len(profiles) > 1:
+		accounts, err = profileSessions(sess, profiles, sessionRegion, cfg)
+	default:
+		// ec2 instances of the selected profile have no account columns
+		accounts = []accountSession{{sess: sess}}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cache := cache.New(480*time.Minute, 1440*time.Minute)
+	publicKey, privateKey := utility.SSHKeyGen(cache)
+
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sshAgent *omssh.AgentConn
+	if f.Bool("forward-agent") || f.Bool("add-key-to-agent") {
+		if sshAgent, err = omssh.ConnectAgent(""); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// get list of ec2 instances in every region of every account concurrently
+	if regions, err = expandRegions(regions, awsapi.NewEC2Client(ec2.New(sess))); err != nil {
+		return nil, nil, err
+	}
+	ec2Opts := []awsapi.EC2Option{awsapi.WithFilters(filters)}
+	if len(accounts) == 1 && len(regions) == 1 && terminal.IsTerminal(int(os.Stderr.Fd())) {
+		// large fleets take a while to describe in pages
+		ec2Opts = append(ec2Opts, awsapi.WithProgress(os.Stderr))
+	}
+	targets := map[string]*target{}
+	var ec2Clients []awsapi.EC2Iface
+	eicClients := awsapi.AccountEC2InstanceConnect{}
+	for _, a := range accounts {
+		regional := awsapi.RegionalEC2InstanceConnect{}
+		for _, r := range regions {
+			// credentials are shared between regions, so mfa is asked once
+			regionSess := a.sess.Copy(&aws.Config{Region: aws.String(r)})
+			t := &target{
+				ec2: awsapi.NewEC2Client(ec2.New(regionSess), append(ec2Opts, awsapi.WithRegion(r), awsapi.WithAccount(a.account))...),
+			}
+			if f.Bool("eice") {
+				t.endpoint = eice.NewEndpointClient(ec2.New(regionSess).Client)
+				t.credentials = regionSess.Config.Credentials
+			}
+			targets[targetKey(a.account.ID, r)] = t
+			ec2Clients = append(ec2Clients, t.ec2)
+
+			regional[r] = awsapi.NewEC2InstanceConnectClient(ec2instanceconnect.New(regionSess))
+			if auditLogger != nil {
+				regional[r] = &auditedEC2InstanceConnect{EC2InstanceConnectIface: regional[r], audit: auditLogger, account: a.account.ID, region: r}
+			}
+			if f.Bool("add-key-to-agent") {
+				regional[r] = &agentKeyEC2InstanceConnect{EC2InstanceConnectIface: regional[r], agent: sshAgent, privateKey: privateKey}
+			}
+		}
+		eicClients[a.account.ID] = regional
+	}
+	var ec2Instances []awsapi.EC2
+	if f.String("org-role") != "" {
+		// an account where the role cannot be assumed does not hide the others
+		var errs []error
+		ec2Instances, errs = awsapi.DescribeRunningEC2sSkippingErrors(ec2Clients)
+		if len(errs) == len(ec2Clients) {
+			return nil, nil, errs[0]
+		}
+		logSkippedAccounts(errs)
+	} else if ec2Instances, err = awsapi.DescribeRunningEC2sConcurrently(ec2Clients); err != nil {
+		return nil, nil, err
+	}
+
+	// select ec2 instances, bastions are found in all of them
+	candidates := ec2Instances
+	if expression != nil {
+		if candidates = awsapi.MatchEC2s(ec2Instances, expression); len(candidates) == 0 {
+			return nil, nil, fmt.Errorf("no running ec2 instance matches %s", f.String("match"))
+		}
+	}
+	ec2s, err := selectEC2s(candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bastion *awsapi.EC2
+	if f.Bool("bastion") {
+		if bastion, err = selectBastion(ec2Instances); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	user, err := selectUser(isUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cn := &connector{
+		profile:             profileNames(profiles),
+		targets:             targets,
+		eicClient:           eicClients,
+		user:                user,
+		port:                f.String("port"),
+		publicKey:           publicKey,
+		signer:              signer,
+		knownHosts:          omssh.NewKnownHosts(knownHostsPath, hostKeyMode),
+		consoleFingerprints: f.Bool("console-fingerprints"),
+		inventory:           ec2Instances,
+		bastion:             bastion,
+		proxy:               env,
+		agent:               sshAgent,
+		forwardAgent:        f.Bool("forward-agent"),
+		keepalive:           f.Duration("keepalive"),
+		keepaliveCountMax:   f.Int("keepalive-count-max"),
+		escapeChar:          escapeChar,
+		audit:               auditLogger,
+	}
+	if f.Bool("eice") {
+		cn.eice = true
+		cn.tunnels = map[string]*eice.Tunnel{}
+	}
+	return cn, ec2s, nil
+}
+
+// agentKeyEC2InstanceConnect : adds the ephemeral key to ssh agent each time its public key is sent,
+// as the key is useless after ec2 instance connect removes the public key
+type agentKeyEC2InstanceConnect struct {
+	awsapi.EC2InstanceConnectIface
+	agent      agent.Agent
+	privateKey []byte
+}
+
+func (a *agentKeyEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	ok, err := a.EC2InstanceConnectIface.SendSSHPubKey(p)
+	if err != nil || !ok {
+		return ok, err
+	}
+	// adding the key again restarts its lifetime, and the connection does not depend on the agent
+	if err := omssh.AddKeyToAgent(a.agent, a.privateKey, "omssh ephemeral key", awsapi.PublicKeyLifetime); err != nil {
+		log.Printf("add key to ssh agent: %v\n", err)
+	}
+	return true, nil
+}
+
+// connect : use ec2 instance connect to send public key and connect to ec2 instance
+func (cn *connector) connect(e awsapi.EC2, opts ...omssh.Option) (omssh.Device, error) {
+	if err := awsapi.PushSSHPublicKey(cn.eicClient, e, cn.user, cn.publicKey); err != nil {
+		return nil, err
+	}
+	return cn.dial(e, opts...)
+}
+
+// dial : connect to ec2 instance which the public key has been sent to,
+// through a bastion if the ec2 instance is private or a bastion is selected
+func (cn *connector) dial(e awsapi.EC2, opts ...omssh.Option) (omssh.Device, error) {
+	// the agent is forwarded to the target, not to the bastion
+	if cn.forwardAgent {
+		opts = append(opts, omssh.WithAgentForwarding(cn.agent))
+	}
+	opts = append(opts, omssh.WithEscapeChar(cn.escapeChar))
+
+	if cn.eice {
+		tunnel, err := cn.tunnelFor(e)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("tunnel through %s\n", tunnel.Endpoint.ID)
+		return cn.dialHost(e, e.PrivateIPAddress, append(opts, omssh.WithDial(tunnel.Dial))...)
+	}
+
+	bastion, err := cn.bastionFor(e)
+	if err != nil {
+		return nil, err
+	}
+	if bastion == nil {
+		return cn.dialHost(e, e.PublicIPAddress, opts...)
+	}
+
+	if err := awsapi.PushSSHPublicKey(cn.eicClient, *bastion, cn.user, cn.publicKey); err != nil {
+		return nil, err
+	}
+	jump, err := cn.dialHost(*bastion, bastion.PublicIPAddress)
+	if err != nil {
+		return nil, err
+	}
+	device, err := cn.dialHost(e, e.PrivateIPAddress, append(opts, omssh.WithJump(jump))...)
+	if err != nil {
+		_ = jump.Close()
+		return nil, err
+	}
+	return device, nil
+}
+
+// dialHost : connect to host address of ec2 instance
+func (cn *connector) dialHost(e awsapi.EC2, host string, opts ...omssh.Option) (omssh.Device, error) {
+	// ssh -i <temporary ssh private key> <user>@<ip address>
+	log.Printf("ssh %s@%s -p %s [%s]\n", cn.user, host, cn.port, e.InstanceID)
+
+	hostKeyCallback, err := cn.hostKeyCallback(e)
+	if err != nil {
+		return nil, err
+	}
+	sshClientConfig := omssh.ConfigureSSHClient(cn.user, cn.signer, hostKeyCallback)
+	if sshClientConfig.HostKeyAlgorithms, err = cn.knownHosts.HostKeyAlgorithms(e.InstanceID, net.JoinHostPort(host, cn.port)); err != nil {
+		return nil, err
+	}
+	if cn.agent != nil {
+		sshClientConfig.Auth = append(sshClientConfig.Auth, omssh.AgentAuth(cn.agent))
+	}
+
+	// opts such as jump host take precedence over the proxy
+	dialer, err := cn.proxy.Dialer(net.JoinHostPort(host, cn.port))
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		opts = append([]omssh.Option{omssh.WithDialer(dialer)}, opts...)
+	}
+	if cn.keepalive > 0 {
+		opts = append(opts, omssh.WithKeepalive(cn.keepalive, cn.keepaliveCountMax))
+	}
+
+	// forwards opened by ~C do not go through the audited device
+	var audited *auditedDevice
+	if cn.audit != nil {
+		opts = append(opts, omssh.WithForwardOpened(func(kind string, f omssh.Forward, err error) {
+			if audited != nil {
+				audited.forwardOpened(kind, f, err)
+			}
+		}))
+	}
+
+	device := omssh.NewDevice(host, cn.port, opts...)
+	err = device.SSHConnect(sshClientConfig)
+	if cn.audit == nil {
+		if err != nil {
+			return nil, err
+		}
+		return device, nil
+	}
+
+	event := audit.Event{
+		Type:         audit.Connected,
+		InstanceID:   e.InstanceID,
+		InstanceName: e.InstanceName,
+		Region:       e.Region,
+		Account:      e.AccountID,
+		User:         cn.user,
+		Host:         host,
+	}
+	if err != nil {
+		event.Error = err.Error()
+		cn.audit.Log(event)
+		return nil, err
+	}
+	cn.audit.Log(event)
+	audited = newAuditedDevice(device, cn.audit, event)
+	return audited, nil
+}
+
+// close : close the ssh agent and the audit log
+func (cn *connector) close() {
+	if cn.agent != nil {
+		if err := cn.agent.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := cn.audit.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// hostKeyCallback : verify host key with known_hosts, and with fingerprints in console output if enabled
+func (cn *connector) hostKeyCallback(e awsapi.EC2) (ssh.HostKeyCallback, error) {
+	if !cn.consoleFingerprints {
+		return cn.knownHosts.HostKeyCallback(e.InstanceID), nil
+	}
+
+	t, err := cn.targetOf(e)
+	if err != nil {
+		return nil, err
+	}
+	output, err := t.ec2.GetConsoleOutput(e.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := awsapi.ParseHostKeyFingerprints(output)
+	if len(fingerprints) == 0 {
+		// verification is asked for, so the host key is not trusted on first use instead
+		return nil, &omssh.HostKeyError{
+			Address: e.InstanceID,
+			Err:     errors.New("no ssh host key fingerprints in the console output, connect without --console-fingerprints to check it with known_hosts"),
+		}
+	}
+	return cn.knownHosts.VerifiedHostKeyCallback(e.InstanceID, fingerprints), nil
+}
+
+// bastionFor : bastion to connect to ec2 instance through, nil if connected directly
+func (cn *connector) bastionFor(e awsapi.EC2) (*awsapi.EC2, error) {
+	if cn.bastion != nil && cn.bastion.InstanceID != e.InstanceID {
+		return cn.bastion, nil
+	}
+	if !e.Private() {
+		return nil, nil
+	}
+	bastion, ok := awsapi.FindBastion(cn.inventory, e)
+	if !ok {
+		return nil, fmt.Errorf("%s has no public ip address and no bastion tagged %s=true in %s, select one with --bastion or use --eice", e.InstanceID, awsapi.BastionTag, e.VpcID)
+	}
+	return &bastion, nil
+}
+
+// tunnelFor : tunnel through ec2 instance connect endpoint in the vpc of ec2 instance
+func (cn *connector) tunnelFor(e awsapi.EC2) (*eice.Tunnel, error) {
+	cn.tunnelsMu.Lock()
+	defer cn.tunnelsMu.Unlock()
+
+	if tunnel, ok := cn.tunnels[e.VpcID]; ok {
+		return tunnel, nil
+	}
+
+	t, err := cn.targetOf(e)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := t.endpoint.DescribeInstanceConnectEndpoints(e.VpcID)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, ok := eice.FindEndpoint(endpoints)
+	if !ok {
+		return nil, fmt.Errorf("no available ec2 instance connect endpoint in %s of %s", e.VpcID, e.InstanceID)
+	}
+
+	tunnel := &eice.Tunnel{
+		Endpoint:    endpoint,
+		Region:      e.Region,
+		Credentials: t.credentials,
+	}
+	dialer, err := cn.proxy.Dialer(net.JoinHostPort(endpoint.DNSName, "443"))
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		tunnel.Forward = dialer
+	}
+	cn.tunnels[e.VpcID] = tunnel
+	return tunnel, nil
+}
+
+// targetOf : aws clients of the account and the region of ec2 instance
+func (cn *connector) targetOf(e awsapi.EC2) (*target, error) {
+	t, ok := cn.targets[targetKey(e.AccountID, e.Region)]
+	if !ok {
+		return nil, fmt.Errorf("no aws client in %s of account %s for %s", e.Region, e.AccountID, e.InstanceID)
+	}
+	return t, nil
+}
+
+// waitUntilInstanceStatusOK : wait until status checks of ec2 instances pass in each account and region
+func (cn *connector) waitUntilInstanceStatusOK(instanceIDs []string) error {
+	ec2s := map[string]awsapi.EC2{}
+	for _, e := range cn.inventory {
+		ec2s[e.InstanceID] = e
+	}
+	byTarget := map[*target][]string{}
+	var order []*target
+	for _, id := range instanceIDs {
+		e, ok := ec2s[id]
+		if !ok {
+			return fmt.Errorf("no running ec2 instance %s", id)
+		}
+		t, err := cn.targetOf(e)
+		if err != nil {
+			return err
+		}
+		if _, ok := byTarget[t]; !ok {
+			order = append(order, t)
+		}
+		byTarget[t] = append(byTarget[t], id)
+	}
+
+	for _, t := range order {
+		if err := t.ec2.WaitUntilInstanceStatusOK(byTarget[t]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runner : return runner executing commands on ec2 instances in parallel
+func (cn *connector) runner(concurrency int) *fleet.Runner {
+	return &fleet.Runner{
+		Concurrency:        concurrency,
+		User:               cn.user,
+		PublicKey:          cn.publicKey,
+		EC2InstanceConnect: cn.eicClient,
+		Dial: func(e awsapi.EC2, stdout, stderr io.Writer) (omssh.Device, error) {
+			return cn.dial(e, omssh.WithStdio(nil, stdout, stderr))
+		},
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// ec2Filters : filters of ec2 api of --filter and --tag
+func ec2Filters(specs, tags []string) ([]*ec2.Filter, error) {
+	var filters []*ec2.Filter
+	for _, spec := range specs {
+		f, err := awsapi.ParseFilter(spec)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	for _, tag := range tags {
+		f, err := awsapi.ParseTagFilter(tag)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// expandRegions : replace "all" in regions with every region enabled in the account
+func expandRegions(regions []string, client awsapi.EC2Iface) ([]string, error) {
+	for _, r := range regions {
+		if r == awsapi.AllRegions {
+			return client.DescribeRegions()
+		}
+	}
+	return regions, nil
+}
+
+// selectBastion : select an ec2 instance with public ip address as bastion through fuzzyfinder
+func selectBastion(ec2s []awsapi.EC2) (*awsapi.EC2, error) {
+	var candidates []awsapi.EC2
+	for _, e := range ec2s {
+		if !e.Private() {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no ec2 instance with public ip address to use as bastion")
+	}
+
+	selected, err := awsapi.FinderEC2(candidates)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) > 1 {
+		return nil, errors.New("select only one bastion")
+	}
+	return &selected[0], nil
+}
+
+// selectAll : select every ec2 instance without fuzzyfinder
+func selectAll(ec2s []awsapi.EC2) ([]awsapi.EC2, error) {
+	return ec2s, nil
+}
+
+// selectInstanceID : select ec2 instance of instanceID without fuzzyfinder
+func selectInstanceID(instanceID string) func([]awsapi.EC2) ([]awsapi.EC2, error) {
+	return func(ec2s []awsapi.EC2) ([]awsapi.EC2, error) {
+		for _, e := range ec2s {
+			if e.InstanceID == instanceID {
+				return []awsapi.EC2{e}, nil
+			}
+		}
+		return nil, fmt.Errorf("no running ec2 instance %s", instanceID)
+	}
+}
+
+// selectUser : return ssh user, selected through fuzzyfinder if isUser
+func selectUser(isUser bool) (string, error) {
+	if !isUser {
+		return defaultUser, nil
+	}
+	return awsapi.FinderUsername(defUsers)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+// fakeEC2 : ec2 client which returns console output
+type fakeEC2 struct {
+	awsapi.EC2Iface
+	output string
+}
+
+func (f *fakeEC2) GetConsoleOutput(instanceID string) (string, error) {
+	return f.output, nil
+}
+
+func TestHostKeyCallbackWithConsoleFingerprints(t *testing.T) {
+	e := awsapi.EC2{InstanceID: "i-1234567890", Region: "ap-northeast-1"}
+
+	for _, testcase := range []struct {
+		name   string
+		output string
+		isErr  bool
+	}{
+		{
+			"fingerprints",
+			"-----BEGIN SSH HOST KEY FINGERPRINTS-----\n256 SHA256:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA root@ip-10-0-0-1 (ECDSA)\n-----END SSH HOST KEY FINGERPRINTS-----\n",
+			false,
+		},
+		{"no fingerprints", "cloud-init finished\n", true},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			cn := &connector{
+				targets:             map[string]*target{targetKey("", e.Region): {ec2: &fakeEC2{output: testcase.output}}},
+				knownHosts:          omssh.NewKnownHosts("known_hosts", omssh.HostKeyAsk),
+				consoleFingerprints: true,
+			}
+
+			callback, err := cn.hostKeyCallback(e)
+			if testcase.isErr {
+				if _, ok := err.(*omssh.HostKeyError); !ok {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if callback == nil {
+				t.Error("wrong result: \ncallback is nil")
+			}
+		})
+	}
+}
+
+func TestAgentKeyEC2InstanceConnect(t *testing.T) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	for _, testcase := range []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"sent", nil, 1},
+		{"not sent", errors.New("AccessDeniedException"), 0},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			keyring := agent.NewKeyring()
+			client := &agentKeyEC2InstanceConnect{
+				EC2InstanceConnectIface: &fakeEC2InstanceConnect{err: testcase.err},
+				agent:                   keyring,
+				privateKey:              privateKey,
+			}
+			if _, err := client.SendSSHPubKey(ec2instanceconnect.SendSSHPublicKeyInput{}); err != testcase.err {
+				t.Fatalf("wrong result: \n%v", err)
+			}
+
+			keys, err := keyring.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, len(keys)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"golang.org/x/crypto/ssh"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+// exit codes of errors, which are above exit status of most commands as ssh exits with 255.
+// omssh exits with the exit status of the remote shell or command as it is.
+const (
+	exitError       = 255
+	exitCredentials = 254
+	exitMFA         = 253
+	exitDescribe    = 252
+	exitKeyPush     = 251
+	exitNetwork     = 250
+	exitAuth        = 249
+	exitHostKey     = 248
+)
+
+// exitStatusHelp : exit status in the help, the remote may exit with the codes of omssh too
+const exitStatusHelp = `omssh exits with the exit status of the remote shell or command as it is, 128 + signal number if it is killed by a signal.
+   Its own errors exit with 255 (other), 254 (credentials), 253 (MFA), 252 (describe), 251 (key push),
+   250 (network), 249 (ssh authentication) or 248 (host key verification), and are logged to stderr.
+   The remote may exit with these codes too, e.g. exit 255, and then omssh logs nothing.`
+
+// signalNumbers : numbers of signals in exit-signal of ssh, exit status is 128 + number like shells
+var signalNumbers = map[string]int{
+	"HUP":  1,
+	"INT":  2,
+	"QUIT": 3,
+	"ILL":  4,
+	"ABRT": 6,
+	"FPE":  8,
+	"KILL": 9,
+	"USR1": 10,
+	"SEGV": 11,
+	"USR2": 12,
+	"PIPE": 13,
+	"ALRM": 14,
+	"TERM": 15,
+}
+
+// exitCode : exit code of omssh failed with err
+func exitCode(err error) int {
+	switch e := err.(type) {
+	case *ssh.ExitError:
+		if e.Signal() != "" {
+			return signalExitCode(e.Signal())
+		}
+		return e.ExitStatus()
+	case *awsapi.CredentialsError:
+		return exitCredentials
+	case *awsapi.MFAError:
+		return exitMFA
+	case *awsapi.DescribeError:
+		return exitDescribe
+	case *awsapi.KeyPushError:
+		return exitKeyPush
+	case *omssh.NetworkError, *omssh.ConnectionLostError, *ssh.ExitMissingError:
+		return exitNetwork
+	case *omssh.AuthError:
+		return exitAuth
+	case *omssh.HostKeyError:
+		return exitHostKey
+	}
+	return exitError
+}
+
+// signalExitCode : exit code of the remote killed by signal
+func signalExitCode(signal string) int {
+	if n, ok := signalNumbers[signal]; ok {
+		return 128 + n
+	}
+	return exitError
+}
+
+// isRemoteExit : whether err is exit of the remote shell or command, which has shown why
+func isRemoteExit(err error) bool {
+	_, ok := err.(*ssh.ExitError)
+	return ok
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"credentials", &awsapi.CredentialsError{}, exitCredentials},
+		{"mfa", &awsapi.MFAError{}, exitMFA},
+		{"describe", &awsapi.DescribeError{}, exitDescribe},
+		{"key push", &awsapi.KeyPushError{}, exitKeyPush},
+		{"network", &omssh.NetworkError{}, exitNetwork},
+		{"connection lost", &omssh.ConnectionLostError{}, exitNetwork},
+		{"auth", &omssh.AuthError{}, exitAuth},
+		{"host key", &omssh.HostKeyError{}, exitHostKey},
+		{"other", errors.New("select only one instance"), exitError},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if diff := cmp.Diff(testcase.expected, exitCode(testcase.err)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if isRemoteExit(testcase.err) {
+				t.Error("wrong result: \nremote exit")
+			}
+		})
+	}
+}
+
+func TestExitCodeOfRemoteExit(t *testing.T) {
+	err := &ssh.ExitError{}
+	if !isRemoteExit(err) {
+		t.Fatalf("wrong result: \n%#v", err)
+	}
+	if diff := cmp.Diff(err.ExitStatus(), exitCode(err)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	for signal, expected := range map[string]int{
+		"TERM":  143,
+		"KILL":  137,
+		"WINCH": exitError,
+	} {
+		if diff := cmp.Diff(expected, signalExitCode(signal)); diff != "" {
+			t.Errorf("wrong result: %s\n%s", signal, diff)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// flagValues : values of the global flags, which every subcommand redefines.
+// A flag given after the subcommand takes precedence over the one given before it,
+// e.g. omssh --region us-east-1 exec -- uptime
+type flagValues struct {
+	c *cli.Context
+}
+
+// flagsOf : values of the global flags of the context
+func flagsOf(c *cli.Context) flagValues {
+	return flagValues{c: c}
+}
+
+// global : whether the flag is only given before the subcommand
+func (f flagValues) global(name string) bool {
+	return !f.c.IsSet(name) && f.c.GlobalIsSet(name)
+}
+
+func (f flagValues) String(name string) string {
+	if f.global(name) {
+		return f.c.GlobalString(name)
+	}
+	return f.c.String(name)
+}
+
+func (f flagValues) StringSlice(name string) []string {
+	if f.global(name) {
+		return f.c.GlobalStringSlice(name)
+	}
+	return f.c.StringSlice(name)
+}
+
+func (f flagValues) Bool(name string) bool {
+	if f.global(name) {
+		return f.c.GlobalBool(name)
+	}
+	return f.c.Bool(name)
+}
+
+func (f flagValues) Int(name string) int {
+	if f.global(name) {
+		return f.c.GlobalInt(name)
+	}
+	return f.c.Int(name)
+}
+
+func (f flagValues) Duration(name string) time.Duration {
+	if f.global(name) {
+		return f.c.GlobalDuration(name)
+	}
+	return f.c.Duration(name)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/urfave/cli"
+)
+
+func TestFlagsOf(t *testing.T) {
+	// the audit log of the environment is not a flag given
+	if v, ok := os.LookupEnv("OMSSH_AUDIT_LOG"); ok {
+		os.Unsetenv("OMSSH_AUDIT_LOG")
+		defer os.Setenv("OMSSH_AUDIT_LOG", v)
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		args     []string
+		expected []interface{}
+	}{
+		{
+			"default",
+			[]string{"exec"},
+			[]interface{}{"ap-northeast-1", []string{}, "ask", 0},
+		},
+		{
+			"global flags before the subcommand",
+			[]string{"--region", "us-east-1", "--audit-log", "audit.log", "--strict-host-key-checking", "yes", "--reconnect", "3", "exec"},
+			[]interface{}{"us-east-1", []string{"audit.log"}, "yes", 3},
+		},
+		{
+			"flags of the subcommand take precedence",
+			[]string{"-r", "us-east-1", "exec", "-r", "eu-west-1", "--reconnect", "1"},
+			[]interface{}{"eu-west-1", []string{}, "ask", 1},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var actual []interface{}
+			a := cli.NewApp()
+			a.Flags = flags
+			a.Commands = []cli.Command{
+				{
+					Name:  "exec",
+					Flags: append([]cli.Flag{cli.IntFlag{Name: "parallel, P"}}, flags...),
+					Action: func(c *cli.Context) error {
+						f := flagsOf(c)
+						actual = []interface{}{f.String("region"), f.StringSlice("audit-log"), f.String("strict-host-key-checking"), f.Int("reconnect")}
+						return nil
+					},
+				},
+			}
+			if err := a.Run(append([]string{name}, testcase.args...)); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, actual); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
@@ -1,26 +1,25 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
-	"github.com/patrickmn/go-cache"
+	"github.com/pkg/sftp"
 	"github.com/urfave/cli"
-	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/kenzo0107/omssh"
-	"github.com/kenzo0107/omssh/pkg/awsapi"
-	"github.com/kenzo0107/omssh/pkg/utility"
+	"github.com/kenzo0107/omssh/pkg/fleet"
+	"github.com/kenzo0107/omssh/pkg/transfer"
 
 	latest "github.com/tcnksm/go-latest"
 )
@@ -29,6 +28,8 @@ const (
 	name        = "omssh"
 	version     = "0.0.3"
 	defaultUser = "ubuntu"
+	// defaultRegion : region of the session when every region is described
+	defaultRegion = "ap-northeast-1"
 )
 
 var (
@@ -37,8 +38,28 @@ var (
 	flags = []cli.Flag{
 		cli.StringFlag{
 			Name:  "region, r",
-			Value: "ap-northeast-1",
-			Usage: "aws region",
+			Value: defaultRegion,
+			Usage: "aws regions separated by commas, or all enabled regions by \"all\"",
+		},
+		cli.BoolFlag{
+			Name:  "profiles",
+			Usage: "select several profiles by tab and list ec2 instances of all their accounts",
+		},
+		cli.StringFlag{
+			Name:  "org-role",
+			Usage: "list ec2 instances of every account in the aws organization of the profile, assuming the role in each account",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter, f",
+			Usage: "filter of ec2 api, name=value[,value...], e.g. vpc-id=vpc-xxxxxx or instance-type=m5.*, repeatable",
+		},
+		cli.StringSliceFlag{
+			Name:  "tag, t",
+			Usage: "list ec2 instances with tag Key=Value[,Value...] or Key, repeatable",
+		},
+		cli.StringFlag{
+			Name:  "match",
+			Usage: "list ec2 instances matching expression, e.g. 'tag:Env=prod && type=~m5.*'",
 		},
 		cli.StringFlag{
 			Name:  "port, p",
@@ -49,19 +70,212 @@ var (
 			Name:  "user, u",
 			Usage: "select ssh user",
 		},
+		cli.StringFlag{
+			Name:  "known-hosts",
+			Usage: "known_hosts file (default: ~/.omssh/known_hosts)",
+		},
+		cli.StringFlag{
+			Name:  "strict-host-key-checking",
+			Value: "ask",
+			Usage: "host key checking: ask, strict, accept-new or off",
+		},
+		cli.BoolFlag{
+			Name:  "console-fingerprints",
+			Usage: "verify host key with fingerprints in ec2 console output, refused if there are none",
+		},
+		cli.BoolFlag{
+			Name:  "bastion",
+			Usage: "select a bastion to connect through, private instances use one tagged omssh:bastion=true by default",
+		},
+		cli.BoolFlag{
+			Name:  "forward-agent, A",
+			Usage: "forward ssh agent of SSH_AUTH_SOCK to the instance",
+		},
+		cli.BoolFlag{
+			Name:  "add-key-to-agent",
+			Usage: "add the ephemeral key to ssh agent for 60 seconds, while ec2 instance connect accepts it",
+		},
+		cli.BoolFlag{
+			Name:  "eice",
+			Usage: "connect to private ip addresses through ec2 instance connect endpoints instead of bastions",
+		},
+		cli.DurationFlag{
+			Name:  "keepalive",
+			Value: 30 * time.Second,
+			Usage: "interval of keepalive requests, 0 disables them",
+		},
+		cli.IntFlag{
+			Name:  "keepalive-count-max",
+			Value: 3,
+			Usage: "close the connection when this number of keepalive requests are not replied",
+		},
+		cli.IntFlag{
+			Name:  "reconnect",
+			Usage: "reconnect the shell at most this number of times when the connection is lost",
+		},
+		cli.StringFlag{
+			Name:  "escape-char, e",
+			Value: "~",
+			Usage: "escape character of the shell, ^X for a control character or none to disable",
+		},
+		cli.StringSliceFlag{
+			Name:   "audit-log",
+			EnvVar: "OMSSH_AUDIT_LOG",
+			Usage:  "write audit events to a file path, syslog, syslog://host:port or http(s) webhook url",
+		},
+		cli.StringFlag{
+			Name:  "record",
+			Usage: "record the shell to the file in asciicast v2 format",
+		},
 	}
 
 	app = &cli.App{
-		Name:    name,
-		Version: version,
-		Flags:   flags,
+		Name:        name,
+		Version:     version,
+		Flags:       flags,
+		Description: exitStatusHelp,
 	}
 )
 
 func main() {
 	app.Action = action
+	app.Commands = []cli.Command{
+		{
+			Name:      "exec",
+			Usage:     "execute a command on the selected ec2 instances",
+			ArgsUsage: "-- <command>",
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:  "parallel, P",
+					Value: 10,
+					Usage: "number of instances to execute the command on at once",
+				},
+			}, flags...),
+			Action: execAction,
+		},
+		{
+			Name:      "rollout",
+			Usage:     "execute a command on the selected ec2 instances batch by batch",
+			ArgsUsage: "-- <command>",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "batch, b",
+					Value: "1",
+					Usage: "number or percentage of instances in a batch, e.g. 2 or 25%",
+				},
+				cli.DurationFlag{
+					Name:  "pause",
+					Usage: "pause between batches",
+				},
+				cli.IntFlag{
+					Name:  "max-failures",
+					Usage: "stop when failed instances exceed this number",
+				},
+				cli.BoolFlag{
+					Name:  "wait-status-check",
+					Usage: "wait until ec2 status checks of a batch pass before the next batch",
+				},
+				cli.StringFlag{
+					Name:  "health-check",
+					Usage: "command which must succeed on a batch before the next batch",
+				},
+				cli.DurationFlag{
+					Name:  "health-check-timeout",
+					Value: 5 * time.Minute,
+					Usage: "how long to retry the health check",
+				},
+				cli.DurationFlag{
+					Name:  "health-check-interval",
+					Value: 10 * time.Second,
+					Usage: "interval between health check retries",
+				},
+				cli.StringFlag{
+					Name:  "report",
+					Usage: "write JSON report to the file instead of stdout",
+				},
+			}, flags...),
+			Action: rolloutAction,
+		},
+		{
+			Name:  "tunnel",
+			Usage: "forward ports through the selected ec2 instance",
+			Flags: append([]cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "L",
+					Usage: "local port forwarding [bind_address:]port:host:hostport",
+				},
+				cli.StringSliceFlag{
+					Name:  "R",
+					Usage: "remote port forwarding [bind_address:]port:host:hostport",
+				},
+				cli.BoolFlag{
+					Name:  "shell",
+					Usage: "start a shell while forwarding",
+				},
+			}, flags...),
+			Action: tunnelAction,
+		},
+		{
+			Name:  "socks",
+			Usage: "run a SOCKS5 proxy which connects through the selected ec2 instance",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "D",
+					Value: "1080",
+					Usage: "dynamic port forwarding [bind_address:]port",
+				},
+			}, flags...),
+			Action: socksAction,
+		},
+		{
+			Name:      "cp",
+			Usage:     "copy files between local and ec2 instance with sftp",
+			ArgsUsage: "<source>... <target>, remote path is instance-id:/path",
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:  "recursive, R",
+					Usage: "copy directories recursively",
+				},
+				cli.BoolFlag{
+					Name:  "preserve",
+					Usage: "preserve permissions and modification times",
+				},
+				cli.BoolFlag{
+					Name:  "quiet, q",
+					Usage: "no progress",
+				},
+			}, flags...),
+			Action: cpAction,
+		},
+		{
+			Name:   "list",
+			Usage:  "print the running ec2 instances as json lines, e.g. for jq",
+			Flags:  flags,
+			Action: listAction,
+		},
+		{
+			Name:      "replay",
+			Usage:     "replay a recording of the shell",
+			ArgsUsage: "<file>",
+			Flags: []cli.Flag{
+				cli.Float64Flag{
+					Name:  "speed, s",
+					Value: 1,
+					Usage: "playback speed, 2 is twice as fast",
+				},
+				cli.DurationFlag{
+					Name:  "idle-time-limit, i",
+					Usage: "longest pause between outputs, no limit if 0",
+				},
+			},
+			Action: replayAction,
+		},
+	}
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		if !isRemoteExit(err) {
+			log.Println(err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -105,113 +319,371 @@ func fixVersionStr(v string) string {
 }
 
 func action(c *cli.Context) error {
-	credentialsPath := getCredentialsPath(runtime.GOOS)
-
-	region := c.String("region")
-	isUser := c.Bool("user")
-	port := c.String("port")
+	cn, ec2s, err := newConnector(c)
+	if err != nil {
+		return err
+	}
+	defer cn.close()
+	if len(ec2s) > 1 {
+		return errors.New("select only one instance to start a shell")
+	}
 
-	profiles, err := utility.GetProfiles(credentialsPath)
+	opts, closeRecorder, err := cn.recordOptions(c, ec2s[0])
 	if err != nil {
 		return err
 	}
+	defer closeRecorder()
+
+	return startShell(c, func(shellOpts ...omssh.Option) (omssh.Device, error) {
+		return cn.connect(ec2s[0], append(opts, shellOpts...)...)
+	})
+}
+
+// startShell : start a shell on the device connected with connect,
+// which connects again when the connection is lost if enabled
+func startShell(c *cli.Context, connect func(opts ...omssh.Option) (omssh.Device, error)) error {
+	reconnect := flagsOf(c).Int("reconnect")
+	var opts []omssh.Option
+	if reconnect > 0 {
+		// the shell which has lost the connection does not read stdin any more
+		opts = append(opts, omssh.WithShellInput(omssh.NewShellInput(os.Stdin)))
+	}
 
-	profileWithAssumeRole, err := utility.FinderProfile(profiles)
+	device, err := connect(opts...)
 	if err != nil {
 		return err
 	}
+	defer closeDevice(device)
+	device.SetupIO()
 
-	_p := strings.Split(profileWithAssumeRole, "|")
+	if reconnect <= 0 {
+		return device.StartShell()
+	}
+	r := &omssh.Reconnector{
+		Connect: func() (omssh.Device, error) {
+			return connect(opts...)
+		},
+		MaxAttempts: reconnect,
+		Interval:    time.Second,
+		Status:      os.Stderr,
+	}
+	return r.StartShell(device)
+}
 
-	var sess *session.Session
-	if len(_p) > 1 {
-		profile, roleArn, mfaSerial, sourceProfile := awsapi.GetProfileWithAssumeRole(profileWithAssumeRole)
+func execAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New("no command to execute: omssh exec -- <command>")
+	}
+	cmd := strings.Join(c.Args(), " ")
 
-		sourceSess := awsapi.NewSession(sourceProfile, region)
+	cn, ec2s, err := newConnector(c)
+	if err != nil {
+		return err
+	}
+	defer cn.close()
 
-		f := func(o *stscreds.AssumeRoleProvider) {
-			o.Duration = time.Hour
-			o.RoleSessionName = sourceProfile
-			o.SerialNumber = aws.String(mfaSerial)
-			o.TokenProvider = stscreds.StdinTokenProvider
+	if len(ec2s) > 1 {
+		results := cn.runner(c.Int("parallel")).Run(ec2s, cmd)
+		if err := fleet.PrintSummary(os.Stderr, results); err != nil {
+			return err
+		}
+		for _, r := range results {
+			if !r.OK() {
+				return cli.NewExitError("", 1)
+			}
 		}
+		return nil
+	}
+
+	// forward stdin only when it is piped
+	var stdin io.Reader
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		stdin = os.Stdin
+	}
+
+	device, err := cn.connect(ec2s[0], omssh.WithStdio(stdin, os.Stdout, os.Stderr))
+	if err != nil {
+		return err
+	}
+	defer closeDevice(device)
+	device.SetupIO()
+
+	// exit status of the command is that of omssh
+	return device.Run(cmd)
+}
+
+func rolloutAction(c *cli.Context) error {
+	if !c.Args().Present() {
+		return errors.New("no command to execute: omssh rollout -- <command>")
+	}
+	cmd := strings.Join(c.Args(), " ")
+
+	batch, err := fleet.ParseBatch(c.String("batch"))
+	if err != nil {
+		return err
+	}
+
+	cn, ec2s, err := newConnector(c)
+	if err != nil {
+		return err
+	}
+	defer cn.close()
+
+	runner := cn.runner(batch.SizeOf(len(ec2s)))
+	// stdout is the JSON report, e.g. omssh rollout -- cmd | jq
+	runner.Stdout = os.Stderr
+
+	rollout := &fleet.Rollout{
+		Runner:              runner,
+		Batch:               batch,
+		Pause:               c.Duration("pause"),
+		MaxFailures:         c.Int("max-failures"),
+		HealthCheck:         c.String("health-check"),
+		HealthCheckTimeout:  c.Duration("health-check-timeout"),
+		HealthCheckInterval: c.Duration("health-check-interval"),
+		Log:                 os.Stderr,
+	}
+	if c.Bool("wait-status-check") {
+		rollout.StatusCheck = cn.waitUntilInstanceStatusOK
+	}
 
-		creds := stscreds.NewCredentials(sourceSess, roleArn, f)
+	report := rollout.Run(ec2s, cmd)
 
-		config := aws.Config{
-			Region:      aws.String(region),
-			Credentials: creds,
+	w := io.Writer(os.Stdout)
+	if path := c.String("report"); path != "" {
+		f, err := os.Create(filepath.Clean(path))
+		if err != nil {
+			return err
 		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Println(err)
+			}
+		}()
+		w = f
+	}
+	if err := report.WriteJSON(w); err != nil {
+		return err
+	}
 
-		sess = session.Must(session.NewSessionWithOptions(session.Options{
-			Config:  config,
-			Profile: profile,
-		}))
-	} else {
-		profile := _p[0]
-		sess = awsapi.NewSession(profile, region)
+	if !report.OK() {
+		return cli.NewExitError("", 1)
 	}
+	return nil
+}
 
-	// get list of ec2 instances
-	ec2Client := awsapi.NewEC2Client(ec2.New(sess))
-	ec2Instances, err := ec2Client.DescribeRunningEC2s()
+func tunnelAction(c *cli.Context) error {
+	locals, err := parseForwards(c.StringSlice("L"))
 	if err != nil {
 		return err
 	}
+	remotes, err := parseForwards(c.StringSlice("R"))
+	if err != nil {
+		return err
+	}
+	if len(locals) == 0 && len(remotes) == 0 {
+		return errors.New("no port forwarding: omssh tunnel -L|-R [bind_address:]port:host:hostport")
+	}
 
-	// select an ec2
-	ec2, err := awsapi.FinderEC2(ec2Instances)
+	cn, ec2s, err := newConnector(c)
 	if err != nil {
 		return err
 	}
+	defer cn.close()
+	if len(ec2s) > 1 {
+		return errors.New("select only one instance to forward ports through")
+	}
 
-	user := defaultUser
-	if isUser {
-		u, e := awsapi.FinderUsername(defUsers)
-		if e != nil {
-			return e
+	var opts []omssh.Option
+	if c.Bool("shell") {
+		recordOpts, closeRecorder, err := cn.recordOptions(c, ec2s[0])
+		if err != nil {
+			return err
 		}
-		user = u
+		defer closeRecorder()
+		opts = recordOpts
 	}
 
-	cache := cache.New(480*time.Minute, 1440*time.Minute)
-	publicKey, privateKey := utility.SSHKeyGen(cache)
+	// forwardings are set up again on reconnect
+	connect := func(shellOpts ...omssh.Option) (omssh.Device, error) {
+		device, err := cn.connect(ec2s[0], append(opts, shellOpts...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range locals {
+			if err := device.LocalForward(f); err != nil {
+				closeDevice(device)
+				return nil, err
+			}
+		}
+		for _, f := range remotes {
+			if err := device.RemoteForward(f); err != nil {
+				closeDevice(device)
+				return nil, err
+			}
+		}
+		return device, nil
+	}
 
-	// use ec2 instance connect to send public key
-	ec2instanceconnectSvc := ec2instanceconnect.New(sess)
+	if c.Bool("shell") {
+		return startShell(c, connect)
+	}
 
-	input := ec2instanceconnect.SendSSHPublicKeyInput{
-		AvailabilityZone: aws.String(ec2.AvailabilityZone),
-		InstanceId:       aws.String(ec2.InstanceID),
-		InstanceOSUser:   aws.String(user),
-		SSHPublicKey:     aws.String(publicKey),
+	device, err := connect()
+	if err != nil {
+		return err
 	}
+	defer closeDevice(device)
+	return waitTunnel(device)
+}
 
-	ec2InstanceConnectClient := awsapi.NewEC2InstanceConnectClient(ec2instanceconnectSvc)
-	r, err := ec2InstanceConnectClient.SendSSHPubKey(input)
+func socksAction(c *cli.Context) error {
+	f, err := omssh.ParseDynamicForward(c.String("D"))
+	if err != nil {
+		return err
+	}
 
-	if err != nil || !r {
+	cn, ec2s, err := newConnector(c)
+	if err != nil {
 		return err
 	}
+	defer cn.close()
+	if len(ec2s) > 1 {
+		return errors.New("select only one instance to proxy through")
+	}
 
-	// ssh -i <temporary ssh private key> <user>@<public ip address>
-	log.Printf("ssh %s@%s -p %s [%s]\n", user, ec2.PublicIPAddress, port, ec2.InstanceID)
+	device, err := cn.connect(ec2s[0])
+	if err != nil {
+		return err
+	}
+	defer closeDevice(device)
 
-	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err := device.DynamicForward(f); err != nil {
+		return err
+	}
+	return waitTunnel(device)
+}
+
+func cpAction(c *cli.Context) error {
+	if c.NArg() < 2 {
+		return errors.New("no source or target: omssh cp <source>... <target>")
+	}
+	var paths []transfer.Path
+	for _, arg := range c.Args() {
+		paths = append(paths, transfer.ParsePath(arg))
+	}
+	sources, target := paths[:len(paths)-1], paths[len(paths)-1]
+
+	var instanceID string
+	var patterns []string
+	for _, p := range sources {
+		if p.Remote() == target.Remote() {
+			return errors.New("copy between local and ec2 instance: either sources or target must be instance-id:/path")
+		}
+		if p.Remote() {
+			if instanceID != "" && p.InstanceID != instanceID {
+				return errors.New("sources must be on the same ec2 instance")
+			}
+			instanceID = p.InstanceID
+		}
+		patterns = append(patterns, p.Path)
+	}
+	if target.Remote() {
+		instanceID = target.InstanceID
+	}
+
+	cn, ec2s, err := newConnectorSelecting(c, selectInstanceID(instanceID))
 	if err != nil {
 		return err
 	}
+	defer cn.close()
 
-	sshClientConfig := omssh.ConfigureSSHClient(user, signer)
+	device, err := cn.connect(ec2s[0])
+	if err != nil {
+		return err
+	}
+	defer closeDevice(device)
 
-	device := omssh.NewDevice(ec2.PublicIPAddress, port)
-	if err := device.SSHConnect(sshClientConfig); err != nil {
+	client, err := sftp.NewClient(device.Client())
+	if err != nil {
 		return err
 	}
-	device.SetupIO()
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	copier := &transfer.Copier{
+		Recursive: c.Bool("recursive"),
+		Preserve:  c.Bool("preserve"),
+	}
+	if !c.Bool("quiet") {
+		copier.Progress = os.Stderr
+	}
 
-	if err := device.StartShell(); err != nil {
+	if target.Remote() {
+		return copier.Upload(client, patterns, target.Path)
+	}
+	return copier.Download(client, patterns, target.Path)
+}
+
+func listAction(c *cli.Context) error {
+	cn, ec2s, err := newConnectorSelecting(c, selectAll)
+	if err != nil {
 		return err
 	}
+	defer cn.close()
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, e := range ec2s {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func parseForwards(specs []string) ([]omssh.Forward, error) {
+	var forwards []omssh.Forward
+	for _, spec := range specs {
+		f, err := omssh.ParseForward(spec)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+	return forwards, nil
+}
+
+// waitTunnel : wait until interrupted or the connection is closed
+func waitTunnel(device omssh.Device) error {
+	log.Println("forwarding ports, press Ctrl-C to stop")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- device.Wait()
+	}()
+
+	select {
+	case <-sig:
+		return nil
+	case err := <-closed:
+		if omssh.IsConnectionLost(err) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("connection closed: %v", err)
+		}
+		return errors.New("connection closed by the remote")
+	}
+}
+
+// closeDevice : close connection which the remote may have already closed
+func closeDevice(device omssh.Device) {
+	_ = device.Close()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/asciicast"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+// recordOptions : options recording the shell on ec2 instance to the file of --record, none if not recording.
+// close must be called after the shell exits.
+func (cn *connector) recordOptions(c *cli.Context, e awsapi.EC2) (opts []omssh.Option, close func(), err error) {
+	path := flagsOf(c).String("record")
+	if path == "" {
+		return nil, func() {}, nil
+	}
+
+	// recordings may have secrets typed or shown in the shell
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	width, height, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 25
+	}
+	w, err := asciicast.NewWriter(f, asciicast.Header{
+		Width:  width,
+		Height: height,
+		Title:  fmt.Sprintf("%s@%s (%s)", cn.user, e.InstanceName, e.InstanceID),
+		Env: map[string]string{
+			"TERM": os.Getenv("TERM"),
+		},
+		Metadata: &asciicast.Metadata{
+			InstanceID: e.InstanceID,
+			Profile:    cn.profile,
+			User:       cn.user,
+			Region:     e.Region,
+		},
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	log.Printf("recording to %s\n", path)
+	return []omssh.Option{omssh.WithRecorder(w)}, func() {
+		if err := w.Close(); err != nil {
+			log.Printf("recording to %s: %v\n", path, err)
+		}
+	}, nil
+}
+
+func replayAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("no recording to replay: omssh replay <file>")
+	}
+	path := c.Args().First()
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		return err
+	}
+	if m := r.Header.Metadata; m != nil {
+		log.Printf("%s@%s in %s with profile %s, recorded at %s\n",
+			m.User, m.InstanceID, m.Region, m.Profile, time.Unix(r.Header.Timestamp, 0).Format(time.RFC3339))
+	}
+
+	p := &asciicast.Player{
+		Speed:         c.Float64("speed"),
+		IdleTimeLimit: c.Duration("idle-time-limit"),
+	}
+	return p.Play(os.Stdout, r)
+}
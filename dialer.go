@@ -0,0 +1,168 @@
+package omssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Dialer : opens the connection which ssh runs over to the target address
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// DialerFunc : function as Dialer
+type DialerFunc func(network, address string) (net.Conn, error)
+
+// Dial : call f
+func (f DialerFunc) Dial(network, address string) (net.Conn, error) {
+	return f(network, address)
+}
+
+// ProxyError : failure of a hop through proxy, either to the proxy itself or from the proxy to the target
+type ProxyError struct {
+	// Proxy : kind and address of the proxy, e.g. "http proxy 10.0.0.1:3128"
+	Proxy string
+	// Target : address requested through the proxy, empty if the proxy is unreachable
+	Target string
+	Err    error
+}
+
+func (e *ProxyError) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf("connect to %s: %v", e.Proxy, e.Err)
+	}
+	return fmt.Sprintf("%s failed to connect to %s: %v", e.Proxy, e.Target, e.Err)
+}
+
+// DirectDialer : connects to the target with tcp
+type DirectDialer struct {
+	Timeout time.Duration
+}
+
+// Dial : connect to address with tcp
+func (d *DirectDialer) Dial(network, address string) (net.Conn, error) {
+	return net.DialTimeout(network, address, d.Timeout)
+}
+
+// ProxyJumpDialer : connects to the target through the ssh connection of the jump host like ssh -J
+type ProxyJumpDialer struct {
+	Jump Device
+}
+
+// Dial : open a direct-tcpip channel to address on the jump host
+func (d *ProxyJumpDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.Jump.Client().Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s through jump host: %v", address, err)
+	}
+	return conn, nil
+}
+
+// HTTPConnectDialer : connects to the target through http proxy with CONNECT method
+type HTTPConnectDialer struct {
+	// ProxyAddress : host:port of the http proxy
+	ProxyAddress string
+	// User : basic authentication of the proxy, no authentication if nil
+	User *url.Userinfo
+	// Forward : dialer to the proxy, DirectDialer if nil
+	Forward Dialer
+}
+
+// Dial : send CONNECT request of address to the proxy
+func (d *HTTPConnectDialer) Dial(network, address string) (net.Conn, error) {
+	name := "http proxy " + d.ProxyAddress
+	forward := d.Forward
+	if forward == nil {
+		forward = &DirectDialer{}
+	}
+	conn, err := forward.Dial("tcp", d.ProxyAddress)
+	if err != nil {
+		return nil, &ProxyError{Proxy: name, Err: err}
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if d.User != nil {
+		password, _ := d.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, &ProxyError{Proxy: name, Err: err}
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, &ProxyError{Proxy: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			return nil, &ProxyError{Proxy: name, Err: fmt.Errorf("authentication failed: %s", resp.Status)}
+		}
+		return nil, &ProxyError{Proxy: name, Target: address, Err: fmt.Errorf("CONNECT: %s", resp.Status)}
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn : connection with data read ahead from the proxy
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// socksConnDialer : socks dialer of golang.org/x/net/proxy which handshakes over a given connection
+type socksConnDialer interface {
+	DialWithConn(ctx context.Context, c net.Conn, network, address string) (net.Addr, error)
+}
+
+// NewSOCKS5Dialer : dialer connecting to the target through SOCKS5 proxy, auth and forward can be nil
+func NewSOCKS5Dialer(proxyAddress string, auth *proxy.Auth, forward Dialer) (Dialer, error) {
+	if forward == nil {
+		forward = &DirectDialer{}
+	}
+	d, err := proxy.SOCKS5("tcp", proxyAddress, auth, forward)
+	if err != nil {
+		return nil, err
+	}
+	cd, ok := d.(socksConnDialer)
+	if !ok {
+		return nil, fmt.Errorf("socks5 proxy %s: unsupported dialer %T", proxyAddress, d)
+	}
+
+	name := "socks5 proxy " + proxyAddress
+	return DialerFunc(func(network, address string) (net.Conn, error) {
+		conn, err := forward.Dial("tcp", proxyAddress)
+		if err != nil {
+			return nil, &ProxyError{Proxy: name, Err: err}
+		}
+		if _, err := cd.DialWithConn(context.Background(), conn, network, address); err != nil {
+			_ = conn.Close()
+			return nil, &ProxyError{Proxy: name, Target: address, Err: err}
+		}
+		return conn, nil
+	}), nil
+}
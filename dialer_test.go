@@ -0,0 +1,225 @@
+package omssh
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
+)
+
+// httpProxy : listen as http proxy accepting CONNECT, with basic authentication if user is not nil
+func httpProxy(t *testing.T, user *url.Userinfo) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go handleHTTPProxy(conn, user)
+		}
+	}()
+	return l
+}
+
+func handleHTTPProxy(conn net.Conn, user *url.Userinfo) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		log.Printf("Failed to read request (%s)", err)
+		_ = conn.Close()
+		return
+	}
+	if req.Method != "CONNECT" {
+		fmt.Fprint(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		_ = conn.Close()
+		return
+	}
+	if user != nil {
+		password, _ := user.Password()
+		r := &http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}
+		u, p, ok := r.BasicAuth()
+		if !ok || u != user.Username() || p != password {
+			fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			_ = conn.Close()
+			return
+		}
+	}
+
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		fmt.Fprint(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		_ = conn.Close()
+		return
+	}
+	fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	pipe(conn, target)
+}
+
+// echoThrough : send msg to the echo server through dialer and return the reply
+func echoThrough(t *testing.T, dialer Dialer, address, msg string) string {
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := fmt.Fprintln(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func TestDialers(t *testing.T) {
+	echoListener := echoServer(t)
+	defer func() {
+		if err := echoListener.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	echoAddress := echoListener.Addr().String()
+
+	for _, testcase := range []struct {
+		name string
+		call func(t *testing.T)
+	}{
+		{
+			"direct",
+			func(t *testing.T) {
+				if diff := cmp.Diff("hoge\n", echoThrough(t, &DirectDialer{}, echoAddress, "hoge")); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"proxy jump",
+			func(t *testing.T) {
+				jump := connectTestSSHServer(t)
+				defer func() {
+					if err := jump.Close(); err != nil {
+						t.Error(err)
+					}
+				}()
+
+				if diff := cmp.Diff("hoge\n", echoThrough(t, &ProxyJumpDialer{Jump: jump}, echoAddress, "hoge")); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"http connect with authentication",
+			func(t *testing.T) {
+				user := url.UserPassword("hoge", "moge")
+				l := httpProxy(t, user)
+				defer func() {
+					if err := l.Close(); err != nil {
+						t.Error(err)
+					}
+				}()
+
+				d := &HTTPConnectDialer{ProxyAddress: l.Addr().String(), User: user}
+				if diff := cmp.Diff("hoge\n", echoThrough(t, d, echoAddress, "hoge")); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+
+				// the proxy refuses
+				d.User = url.UserPassword("hoge", "fuga")
+				_, err := d.Dial("tcp", echoAddress)
+				if e, ok := err.(*ProxyError); !ok || e.Target != "" {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+
+				// the proxy cannot reach the target
+				d.User = user
+				target := net.JoinHostPort("127.0.0.1", availablePort())
+				_, err = d.Dial("tcp", target)
+				if e, ok := err.(*ProxyError); !ok || e.Target != target {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+			},
+		},
+		{
+			"http proxy unreachable",
+			func(t *testing.T) {
+				d := &HTTPConnectDialer{ProxyAddress: net.JoinHostPort("127.0.0.1", availablePort())}
+				_, err := d.Dial("tcp", echoAddress)
+				if e, ok := err.(*ProxyError); !ok || e.Target != "" {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+			},
+		},
+		{
+			"socks5",
+			func(t *testing.T) {
+				device := connectTestSSHServer(t)
+				defer func() {
+					if err := device.Close(); err != nil {
+						t.Error(err)
+					}
+				}()
+				proxyAddress := net.JoinHostPort("127.0.0.1", availablePort())
+				if err := device.DynamicForward(Forward{BindAddress: proxyAddress}); err != nil {
+					t.Fatal(err)
+				}
+
+				d, err := NewSOCKS5Dialer(proxyAddress, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("hoge\n", echoThrough(t, d, echoAddress, "hoge")); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+
+				target := net.JoinHostPort("127.0.0.1", availablePort())
+				_, err = d.Dial("tcp", target)
+				if e, ok := err.(*ProxyError); !ok || e.Target != target {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+			},
+		},
+	} {
+		t.Run(testcase.name, testcase.call)
+	}
+}
+
+func TestSSHConnectWithDialer(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	l := httpProxy(t, nil)
+	defer func() {
+		if err := l.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	device := NewDevice("127.0.0.1", testPort, WithDialer(&HTTPConnectDialer{ProxyAddress: l.Addr().String()}))
+	sshClientConfig := ConfigureSSHClient("testUser", signer, ssh.FixedHostKey(signer.PublicKey()))
+	if err := device.SSHConnect(sshClientConfig); err != nil {
+		t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+	}
+	if err := device.Close(); err != nil {
+		t.Error(err)
+	}
+}
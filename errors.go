@@ -0,0 +1,75 @@
+package omssh
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Errors of ssh connections are classified by these types, and a remote shell or command
+// which exits with non-zero status or by a signal is *ssh.ExitError.
+
+// NetworkError : the connection to Address cannot be opened or is lost, e.g. unreachable, timed out or through a proxy
+type NetworkError struct {
+	Address string
+	Err     error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("connect to %s: %v", e.Address, e.Err)
+}
+
+// AuthError : the remote refused ssh authentication of User
+type AuthError struct {
+	Address string
+	User    string
+	Err     error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authenticate %s@%s: %v", e.User, e.Address, e.Err)
+}
+
+// HostKeyError : the host key of Address is not trusted,
+// Err is *HostKeyMismatchError, *HostKeyUnknownError, *HostKeyFingerprintError or others of the callback
+type HostKeyError struct {
+	Address string
+	Err     error
+}
+
+func (e *HostKeyError) Error() string {
+	return fmt.Sprintf("verify host key of %s: %v", e.Address, e.Err)
+}
+
+// capturingHostKeyCallback : config whose host key callback keeps its error,
+// as ssh returns the error of the handshake in a string
+func capturingHostKeyCallback(config *ssh.ClientConfig) (*ssh.ClientConfig, *error) {
+	var hostKeyErr error
+	callback := config.HostKeyCallback
+	if callback == nil {
+		// ssh refuses config without the callback
+		return config, &hostKeyErr
+	}
+	c := *config
+	c.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			hostKeyErr = err
+			return err
+		}
+		return nil
+	}
+	return &c, &hostKeyErr
+}
+
+// handshakeError : classify error of the ssh handshake with address
+func handshakeError(address, user string, err, hostKeyErr error) error {
+	switch {
+	case hostKeyErr != nil:
+		return &HostKeyError{Address: address, Err: hostKeyErr}
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return &AuthError{Address: address, User: user, Err: err}
+	}
+	return &NetworkError{Address: address, Err: err}
+}
@@ -0,0 +1,109 @@
+package omssh
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// refusingSSHServer : ssh server which refuses every public key
+func refusingSSHServer(t *testing.T, signer ssh.Signer) net.Listener {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, errors.New("not authorized")
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				// the handshake fails
+				_, _, _, _ = ssh.NewServerConn(conn, config)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func TestSSHConnectErrors(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	refusing := refusingSSHServer(t, signer)
+	defer func() {
+		if err := refusing.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	_, refusingPort, err := net.SplitHostPort(refusing.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherHostKey := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return &HostKeyMismatchError{Host: hostname}
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		port     string
+		callback ssh.HostKeyCallback
+		check    func(err error) bool
+	}{
+		{
+			name:     "network",
+			port:     availablePort(),
+			callback: ssh.FixedHostKey(signer.PublicKey()),
+			check: func(err error) bool {
+				_, ok := err.(*NetworkError)
+				return ok
+			},
+		},
+		{
+			name:     "host key",
+			port:     testPort,
+			callback: otherHostKey,
+			check: func(err error) bool {
+				e, ok := err.(*HostKeyError)
+				if !ok {
+					return false
+				}
+				_, ok = e.Err.(*HostKeyMismatchError)
+				return ok
+			},
+		},
+		{
+			name:     "auth",
+			port:     refusingPort,
+			callback: ssh.FixedHostKey(signer.PublicKey()),
+			check: func(err error) bool {
+				e, ok := err.(*AuthError)
+				return ok && e.User == "testUser"
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			device := NewDevice("127.0.0.1", testcase.port)
+			err := device.SSHConnect(ConfigureSSHClient("testUser", signer, testcase.callback))
+			if !testcase.check(err) {
+				t.Errorf("wrong result: \n%#v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package omssh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultEscapeChar : escape character of ssh
+const DefaultEscapeChar = '~'
+
+const escapeHelp = `Supported escape sequences:
+ %[1]c.   - terminate connection
+ %[1]cC   - open a command line to add port forwardings: -L, -R or -D
+ %[1]c^Z  - suspend ssh
+ %[1]c#   - list forwardings
+ %[1]c?   - this message
+ %[1]c%[1]c   - send the escape character by typing it twice
+(Note that escapes are only recognized immediately after newline.)
+`
+
+// ParseEscapeChar : parse escape character of ssh -e, a single character, "^X" for a control character,
+// or "none" which disables escape sequences and is 0
+func ParseEscapeChar(s string) (byte, error) {
+	switch {
+	case s == "none":
+		return 0, nil
+	case len(s) == 1:
+		return s[0], nil
+	case len(s) == 2 && s[0] == '^':
+		return s[1] & 0x1f, nil
+	}
+	return 0, fmt.Errorf("invalid escape character %q: a character, ^X or none", s)
+}
+
+// WithEscapeChar : recognise escape sequences of c after a newline in the shell, disabled if c is 0
+func WithEscapeChar(c byte) Option {
+	return func(d *SSHDevice) {
+		d.escapeChar = c
+	}
+}
+
+// WithForwardOpened : call fn for each port forwarding opened by ~C, e.g. to audit it
+func WithForwardOpened(fn func(kind string, f Forward, err error)) Option {
+	return func(d *SSHDevice) {
+		d.forwardOpened = fn
+	}
+}
+
+// escapeActions : what escape sequences do
+type escapeActions struct {
+	disconnect func()
+	suspend    func() error
+	forwards   func() []string
+	command    func(line string) error
+}
+
+// escapeFilter : stdin of the shell which escape sequences after a newline are taken from, like ssh.
+// Messages are written to w, with CRLF as the terminal is in raw mode.
+type escapeFilter struct {
+	r       io.Reader
+	w       io.Writer
+	char    byte
+	actions escapeActions
+
+	lineStart bool
+	escaped   bool
+	// command : line of ~C command, nil if not reading it
+	command []byte
+
+	buf []byte
+	out []byte
+	err error
+}
+
+func newEscapeFilter(r io.Reader, w io.Writer, char byte, actions escapeActions) *escapeFilter {
+	return &escapeFilter{
+		r:       r,
+		w:       w,
+		char:    char,
+		actions: actions,
+		// the beginning of the session counts as after a newline
+		lineStart: true,
+		buf:       make([]byte, 1024),
+	}
+}
+
+func (f *escapeFilter) Read(p []byte) (int, error) {
+	for len(f.out) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		n, err := f.r.Read(f.buf)
+		f.err = err
+		for _, b := range f.buf[:n] {
+			f.filter(b)
+		}
+	}
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+// filter : append b to the input of the shell unless it is a part of escape sequences
+func (f *escapeFilter) filter(b byte) {
+	switch {
+	case f.command != nil:
+		f.readCommand(b)
+	case f.escaped:
+		f.escaped = false
+		if f.escape(b) {
+			f.lineStart = true
+			return
+		}
+		// typing the escape character twice sends it once
+		if b != f.char {
+			f.out = append(f.out, f.char)
+		}
+		f.out = append(f.out, b)
+		f.lineStart = isNewline(b)
+	case f.lineStart && b == f.char:
+		f.escaped = true
+	default:
+		f.out = append(f.out, b)
+		f.lineStart = isNewline(b)
+	}
+}
+
+// escape : run escape sequence of b, false if it is not an escape sequence
+func (f *escapeFilter) escape(b byte) bool {
+	switch b {
+	case '.':
+		f.printf("%c.\r\n", f.char)
+		f.actions.disconnect()
+	case 0x1a:
+		f.printf("%c^Z [suspend ssh]\r\n", f.char)
+		if err := f.actions.suspend(); err != nil {
+			f.printf("%v\r\n", err)
+		}
+	case '#':
+		f.printf("%c#\r\nThe following forwardings are open:\r\n", f.char)
+		for _, fw := range f.actions.forwards() {
+			f.printf("  %s\r\n", fw)
+		}
+	case 'C':
+		f.printf("\r\nssh> ")
+		f.command = []byte{}
+	case '?':
+		f.printf("%c?\r\n", f.char)
+		f.printf("%s", strings.Replace(fmt.Sprintf(escapeHelp, f.char), "\n", "\r\n", -1))
+	default:
+		return false
+	}
+	return true
+}
+
+// readCommand : read the command line of ~C with echo until a newline
+func (f *escapeFilter) readCommand(b byte) {
+	switch {
+	case isNewline(b):
+		line := string(f.command)
+		f.command = nil
+		f.printf("\r\n")
+		if err := f.actions.command(line); err != nil {
+			f.printf("%v\r\n", err)
+		}
+	case b == 0x03 || b == 0x1b:
+		// Ctrl-C or ESC cancels the command line
+		f.command = nil
+		f.printf("\r\n")
+	case b == 0x7f || b == 0x08:
+		if len(f.command) > 0 {
+			f.command = f.command[:len(f.command)-1]
+			f.printf("\b \b")
+		}
+	default:
+		f.command = append(f.command, b)
+		f.printf("%c", b)
+	}
+}
+
+func (f *escapeFilter) printf(format string, a ...interface{}) {
+	// messages to the local terminal are best effort
+	_, _ = fmt.Fprintf(f.w, format, a...)
+}
+
+func isNewline(b byte) bool {
+	return b == '\r' || b == '\n'
+}
+
+// escapeCommand : add port forwarding of the ~C command line, e.g. "-L 8080:localhost:80"
+func (d *SSHDevice) escapeCommand(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if len(line) < 2 {
+		return fmt.Errorf("invalid command %q: -L, -R or -D", line)
+	}
+	opt, spec := line[:2], strings.TrimSpace(line[2:])
+
+	switch opt {
+	case "-L", "-R":
+		f, err := ParseForward(spec)
+		if err != nil {
+			return err
+		}
+		if opt == "-L" {
+			return d.forwardOpenedBy("local", f, d.LocalForward(f))
+		}
+		return d.forwardOpenedBy("remote", f, d.RemoteForward(f))
+	case "-D":
+		f, err := ParseDynamicForward(spec)
+		if err != nil {
+			return err
+		}
+		return d.forwardOpenedBy("dynamic", f, d.DynamicForward(f))
+	}
+	return fmt.Errorf("invalid command %q: -L, -R or -D", line)
+}
+
+// forwardOpenedBy : tell the port forwarding opened by ~C and its error
+func (d *SSHDevice) forwardOpenedBy(kind string, f Forward, err error) error {
+	if d.forwardOpened != nil {
+		d.forwardOpened(kind, f, err)
+	}
+	return err
+}
+
+// forwardList : running port forwardings
+func (d *SSHDevice) forwardList() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]string, 0, len(d.forwards))
+	for _, fw := range d.forwards {
+		list = append(list, fmt.Sprintf("%s %s", fw.kind, fw.Forward))
+	}
+	return list
+}
+
+// disconnect : close the connection on ~. which ends the shell without error
+func (d *SSHDevice) disconnect() {
+	d.mu.Lock()
+	d.disconnected = true
+	d.mu.Unlock()
+	_ = d.client.Close()
+}
@@ -0,0 +1,199 @@
+package omssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseEscapeChar(t *testing.T) {
+	for _, testcase := range []struct {
+		spec     string
+		expected byte
+		isErr    bool
+	}{
+		{"~", '~', false},
+		{"%", '%', false},
+		{"^]", 0x1d, false},
+		{"none", 0, false},
+		{"", 0, true},
+		{"~~", 0, true},
+	} {
+		t.Run(testcase.spec, func(t *testing.T) {
+			c, err := ParseEscapeChar(testcase.spec)
+			if testcase.isErr {
+				if err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, c); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+// escapeCalls : escape actions which record what is called
+type escapeCalls struct {
+	calls []string
+}
+
+func (e *escapeCalls) actions() escapeActions {
+	return escapeActions{
+		disconnect: func() { e.calls = append(e.calls, "disconnect") },
+		suspend: func() error {
+			e.calls = append(e.calls, "suspend")
+			return errors.New("not suspended")
+		},
+		forwards: func() []string { return []string{"local 127.0.0.1:8080 -> localhost:80"} },
+		command: func(line string) error {
+			e.calls = append(e.calls, "command "+line)
+			return nil
+		},
+	}
+}
+
+func TestEscapeFilter(t *testing.T) {
+	for _, testcase := range []struct {
+		name             string
+		input            string
+		expectedInput    string
+		expectedCalls    []string
+		expectedMessages []string
+	}{
+		{
+			name:          "no escape",
+			input:         "ls\rcd ~\r",
+			expectedInput: "ls\rcd ~\r",
+		},
+		{
+			name:          "disconnect at the beginning",
+			input:         "~.",
+			expectedCalls: []string{"disconnect"},
+		},
+		{
+			name:          "disconnect after newline",
+			input:         "ls\r~.",
+			expectedInput: "ls\r",
+			expectedCalls: []string{"disconnect"},
+		},
+		{
+			name:          "not after newline",
+			input:         "a~.",
+			expectedInput: "a~.",
+		},
+		{
+			name:          "escape character twice",
+			input:         "~~.",
+			expectedInput: "~.",
+		},
+		{
+			name:          "not an escape sequence",
+			input:         "~x\r",
+			expectedInput: "~x\r",
+		},
+		{
+			name:             "suspend",
+			input:            "~\x1a",
+			expectedCalls:    []string{"suspend"},
+			expectedMessages: []string{"[suspend ssh]", "not suspended"},
+		},
+		{
+			name:             "list forwardings",
+			input:            "~#",
+			expectedMessages: []string{"local 127.0.0.1:8080 -> localhost:80"},
+		},
+		{
+			name:             "command line",
+			input:            "~C-L 8080:localhost:8x\x7f0\recho\r",
+			expectedInput:    "echo\r",
+			expectedCalls:    []string{"command -L 8080:localhost:80"},
+			expectedMessages: []string{"ssh> "},
+		},
+		{
+			name:          "command line cancelled",
+			input:         "~C-L\x03ls\r",
+			expectedInput: "ls\r",
+		},
+		{
+			name:             "help",
+			input:            "~?",
+			expectedMessages: []string{"~.   - terminate connection\r\n"},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var messages bytes.Buffer
+			calls := &escapeCalls{}
+			f := newEscapeFilter(strings.NewReader(testcase.input), &messages, '~', calls.actions())
+
+			input, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expectedInput, string(input)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.expectedCalls, calls.calls); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			for _, m := range testcase.expectedMessages {
+				if !strings.Contains(messages.String(), m) {
+					t.Errorf("wrong result: \n%q does not contain %q", messages.String(), m)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeCommand(t *testing.T) {
+	device := connectTestSSHServer(t)
+	defer closeTestDevice(t, device)
+	d := device.(*SSHDevice)
+
+	if err := d.escapeCommand("-L 127.0.0.1:" + availablePort() + ":localhost:80"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.escapeCommand("-D127.0.0.1:" + availablePort()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.escapeCommand("-X 8080"); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+
+	list := d.forwardList()
+	if diff := cmp.Diff(2, len(list)); diff != "" {
+		t.Fatalf("wrong result: \n%s", diff)
+	}
+	if !strings.HasPrefix(list[0], "local ") || !strings.HasPrefix(list[1], "dynamic ") {
+		t.Errorf("wrong result: \n%v", list)
+	}
+}
+
+func TestEscapeCommandForwardOpened(t *testing.T) {
+	var opened []string
+	device := connectTestSSHServer(t, WithForwardOpened(func(kind string, f Forward, err error) {
+		opened = append(opened, fmt.Sprintf("%s %v", kind, err))
+	}))
+	defer closeTestDevice(t, device)
+	d := device.(*SSHDevice)
+
+	input := "~C-L 127.0.0.1:" + availablePort() + ":localhost:80\r~C-D 127.0.0.1:x\r~C-X\r"
+	f := newEscapeFilter(strings.NewReader(input), ioutil.Discard, '~', escapeActions{command: d.escapeCommand})
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// forwards which are not parsed are not opened
+	if diff := cmp.Diff([]string{"local <nil>"}, opened); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
@@ -0,0 +1,235 @@
+package omssh
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Forward : port forwarding from BindAddress to DialAddress
+type Forward struct {
+	BindAddress string
+	DialAddress string
+}
+
+// ParseForward : parse port forwarding specification "[bind_address:]port:host:hostport" of ssh -L and -R
+func ParseForward(spec string) (Forward, error) {
+	f, err := splitForward(spec)
+	if err != nil {
+		return Forward{}, err
+	}
+
+	var bindHost, bindPort, host, hostPort string
+	switch len(f) {
+	case 3:
+		bindHost, bindPort, host, hostPort = "localhost", f[0], f[1], f[2]
+	case 4:
+		bindHost, bindPort, host, hostPort = f[0], f[1], f[2], f[3]
+	default:
+		return Forward{}, fmt.Errorf("invalid forwarding %q: [bind_address:]port:host:hostport", spec)
+	}
+
+	for _, p := range []string{bindPort, hostPort} {
+		if n, err := strconv.Atoi(p); err != nil || n < 0 || n > 65535 {
+			return Forward{}, fmt.Errorf("invalid forwarding %q: bad port %q", spec, p)
+		}
+	}
+	if host == "" {
+		return Forward{}, fmt.Errorf("invalid forwarding %q: no host", spec)
+	}
+
+	return Forward{
+		BindAddress: net.JoinHostPort(bindHost, bindPort),
+		DialAddress: net.JoinHostPort(host, hostPort),
+	}, nil
+}
+
+// splitForward : split by colons except ones in brackets of ipv6 address
+func splitForward(spec string) ([]string, error) {
+	var f []string
+	var b strings.Builder
+	inBracket := false
+	for _, r := range spec {
+		switch {
+		case r == '[' && !inBracket:
+			inBracket = true
+		case r == ']' && inBracket:
+			inBracket = false
+		case r == ':' && !inBracket:
+			f = append(f, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if inBracket {
+		return nil, fmt.Errorf("invalid forwarding %q: unclosed bracket", spec)
+	}
+	return append(f, b.String()), nil
+}
+
+func (f Forward) String() string {
+	if f.DialAddress == "" {
+		return fmt.Sprintf("%s -> socks", f.BindAddress)
+	}
+	return fmt.Sprintf("%s -> %s", f.BindAddress, f.DialAddress)
+}
+
+// forwarder : running port forwarding
+type forwarder struct {
+	Forward
+	kind     string
+	listener net.Listener
+	dial     func(network, address string) (net.Conn, error)
+	// connect : open the other side of an accepted connection, dial DialAddress if nil
+	connect func(conn net.Conn) (net.Conn, error)
+
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// serve : accept connections until the listener is closed
+func (fw *forwarder) serve() {
+	defer fw.wg.Done()
+	for {
+		conn, err := fw.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		fw.wg.Add(1)
+		go func() {
+			defer fw.wg.Done()
+			fw.track(conn, true)
+			defer fw.track(conn, false)
+
+			remote, err := fw.connect(conn)
+			if err != nil {
+				log.Printf("%s forwarding %s: %v\n", fw.kind, fw.Forward, err)
+				_ = conn.Close()
+				return
+			}
+			pipe(conn, remote)
+		}()
+	}
+}
+
+func (fw *forwarder) track(conn net.Conn, add bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if add {
+		if fw.closed {
+			_ = conn.Close()
+			return
+		}
+		fw.conns[conn] = struct{}{}
+	} else {
+		delete(fw.conns, conn)
+	}
+}
+
+// close : stop accepting connections and close forwarded connections
+func (fw *forwarder) close() error {
+	err := fw.listener.Close()
+
+	fw.mu.Lock()
+	fw.closed = true
+	for conn := range fw.conns {
+		_ = conn.Close()
+	}
+	fw.mu.Unlock()
+
+	fw.wg.Wait()
+	log.Printf("%s forwarding %s closed\n", fw.kind, fw.Forward)
+	return err
+}
+
+// LocalForward : listen on BindAddress locally and forward connections to DialAddress from the remote
+func (d *SSHDevice) LocalForward(f Forward) error {
+	l, err := net.Listen("tcp", f.BindAddress)
+	if err != nil {
+		return fmt.Errorf("local forwarding %s: %v", f, err)
+	}
+	d.startForward(&forwarder{
+		Forward:  f,
+		kind:     "local",
+		listener: l,
+		dial:     d.client.Dial,
+	})
+	return nil
+}
+
+// RemoteForward : listen on BindAddress on the remote and forward connections to DialAddress from local.
+// The remote stops listening when the device is closed.
+func (d *SSHDevice) RemoteForward(f Forward) error {
+	l, err := d.client.Listen("tcp", f.BindAddress)
+	if err != nil {
+		return fmt.Errorf("remote forwarding %s: %v", f, err)
+	}
+	d.startForward(&forwarder{
+		Forward:  f,
+		kind:     "remote",
+		listener: l,
+		dial:     net.Dial,
+	})
+	return nil
+}
+
+func (d *SSHDevice) startForward(fw *forwarder) {
+	fw.conns = map[net.Conn]struct{}{}
+	if fw.connect == nil {
+		fw.connect = func(net.Conn) (net.Conn, error) {
+			return fw.dial("tcp", fw.DialAddress)
+		}
+	}
+
+	d.mu.Lock()
+	d.forwards = append(d.forwards, fw)
+	d.mu.Unlock()
+
+	fw.wg.Add(1)
+	go fw.serve()
+	log.Printf("%s forwarding %s\n", fw.kind, fw.Forward)
+}
+
+// closeForwards : close all port forwardings
+func (d *SSHDevice) closeForwards() {
+	d.mu.Lock()
+	forwards := d.forwards
+	d.forwards = nil
+	d.mu.Unlock()
+
+	for _, fw := range forwards {
+		// the listener may have been closed with the connection
+		_ = fw.close()
+	}
+}
+
+// pipe : copy between connections until both directions are done
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		// the error is the end of the connection
+		_, _ = io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go cp(a, b)
+	go cp(b, a)
+	wg.Wait()
+
+	_ = a.Close()
+	_ = b.Close()
+}
@@ -0,0 +1,190 @@
+package omssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseForward(t *testing.T) {
+	for _, testcase := range []struct {
+		spec     string
+		expected Forward
+	}{
+		{"5432:db.internal:5432", Forward{"localhost:5432", "db.internal:5432"}},
+		{"0.0.0.0:8080:localhost:80", Forward{"0.0.0.0:8080", "localhost:80"}},
+		{"[::1]:8080:[fe80::1]:80", Forward{"[::1]:8080", "[fe80::1]:80"}},
+		{":8080:localhost:80", Forward{":8080", "localhost:80"}},
+	} {
+		actual, err := ParseForward(testcase.spec)
+		if err != nil {
+			t.Error(err)
+		}
+		if diff := cmp.Diff(testcase.expected, actual); diff != "" {
+			t.Errorf("wrong result: %s\n%s", testcase.spec, diff)
+		}
+	}
+
+	for _, spec := range []string{"", "5432", "5432:db.internal", "hoge:db.internal:5432", "5432:db.internal:70000", "5432::5432", "[::1:8080:localhost:80"} {
+		if _, err := ParseForward(spec); err == nil {
+			t.Errorf("wrong result: %q\nerr is nil", spec)
+		}
+	}
+}
+
+// echoServer : listen and echo back lines
+func echoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				if _, err := io.Copy(conn, conn); err != nil {
+					log.Printf("Failed to echo (%s)", err)
+				}
+				if err := conn.Close(); err != nil {
+					log.Printf("Failed to close (%s)", err)
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func echo(t *testing.T, address, msg string) string {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := fmt.Fprintln(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func connectTestSSHServer(t *testing.T, opts ...Option) Device {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	device := NewDevice("localhost", testPort, opts...)
+	sshClientConfig := ConfigureSSHClient("testUser", signer, ssh.FixedHostKey(signer.PublicKey()))
+	if err := device.SSHConnect(sshClientConfig); err != nil {
+		t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+	}
+	return device
+}
+
+func TestLocalForward(t *testing.T) {
+	echoListener := echoServer(t)
+	defer func() {
+		if err := echoListener.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	device := connectTestSSHServer(t)
+
+	bindAddress := net.JoinHostPort("127.0.0.1", availablePort())
+	f := Forward{BindAddress: bindAddress, DialAddress: echoListener.Addr().String()}
+	if err := device.LocalForward(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// many connections at once
+	done := make(chan string)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			done <- echo(t, bindAddress, fmt.Sprintf("hoge %d", i))
+		}(i)
+	}
+	received := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		received[<-done] = true
+	}
+	for i := 0; i < 5; i++ {
+		if !received[fmt.Sprintf("hoge %d\n", i)] {
+			t.Errorf("wrong result: \n%v", received)
+		}
+	}
+
+	// unreachable destination does not stop forwarding
+	unreachable := Forward{BindAddress: net.JoinHostPort("127.0.0.1", availablePort()), DialAddress: net.JoinHostPort("127.0.0.1", availablePort())}
+	if err := device.LocalForward(unreachable); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", unreachable.BindAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+	if err := conn.Close(); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff("hoge\n", echo(t, bindAddress, "hoge")); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if err := device.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := net.Dial("tcp", bindAddress); err == nil {
+		t.Error("wrong result: \nlistener is not closed")
+	}
+}
+
+func TestRemoteForward(t *testing.T) {
+	echoListener := echoServer(t)
+	defer func() {
+		if err := echoListener.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	device := connectTestSSHServer(t)
+
+	bindAddress := net.JoinHostPort("127.0.0.1", availablePort())
+	f := Forward{BindAddress: bindAddress, DialAddress: echoListener.Addr().String()}
+	if err := device.RemoteForward(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("hoge\n", echo(t, bindAddress, "hoge")); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("moge\n", echo(t, bindAddress, "moge")); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if err := device.Close(); err != nil {
+		t.Error(err)
+	}
+}
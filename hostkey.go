@@ -0,0 +1,567 @@
+package omssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" // #nosec G505 hashed hostnames of known_hosts are HMAC-SHA1
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyMode : how unknown or changed host keys are handled
+type HostKeyMode int
+
+const (
+	// HostKeyAsk : ask before trusting a host key seen for the first time
+	HostKeyAsk HostKeyMode = iota
+	// HostKeyStrict : refuse hosts not recorded in known_hosts
+	HostKeyStrict
+	// HostKeyAcceptNew : trust new hosts without asking, refuse changed keys
+	HostKeyAcceptNew
+	// HostKeyOff : accept any host key without recording it
+	HostKeyOff
+)
+
+var hostKeyModeNames = map[HostKeyMode]string{
+	HostKeyAsk:       "ask",
+	HostKeyStrict:    "strict",
+	HostKeyAcceptNew: "accept-new",
+	HostKeyOff:       "off",
+}
+
+// ParseHostKeyMode : parse host key mode (ask, strict, accept-new, off)
+func ParseHostKeyMode(s string) (HostKeyMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "ask":
+		return HostKeyAsk, nil
+	case "strict", "yes":
+		return HostKeyStrict, nil
+	case "accept-new":
+		return HostKeyAcceptNew, nil
+	case "off", "no":
+		return HostKeyOff, nil
+	}
+	return HostKeyAsk, fmt.Errorf("unknown host key checking mode %q (ask, strict, accept-new or off)", s)
+}
+
+func (m HostKeyMode) String() string {
+	return hostKeyModeNames[m]
+}
+
+// HostKeyMismatchError : host key differs from the one recorded in known_hosts
+type HostKeyMismatchError struct {
+	Host     string
+	Path     string
+	Line     int
+	Known    string
+	Received string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf(
+		"host key for %s has changed, this may be a man-in-the-middle attack: %s:%d has %s but the server sent %s; "+
+			"if the host was rebuilt, remove that line and connect again",
+		e.Host, e.Path, e.Line, e.Known, e.Received,
+	)
+}
+
+// HostKeyUnknownError : host is not recorded in known_hosts and may not be trusted on first use
+type HostKeyUnknownError struct {
+	Host     string
+	Path     string
+	Received string
+	Reason   string
+}
+
+func (e *HostKeyUnknownError) Error() string {
+	return fmt.Sprintf("host key for %s (%s) is not in %s: %s", e.Host, e.Received, e.Path, e.Reason)
+}
+
+// HostKeyFingerprintError : host key is not one of the fingerprints published by the instance
+type HostKeyFingerprintError struct {
+	Host         string
+	Received     string
+	Fingerprints []string
+}
+
+func (e *HostKeyFingerprintError) Error() string {
+	return fmt.Sprintf(
+		"host key %s for %s does not match any fingerprint in the console output (%s), this may be a man-in-the-middle attack",
+		e.Received, e.Host, strings.Join(e.Fingerprints, ", "),
+	)
+}
+
+// KnownHosts : OpenSSH compatible known_hosts store keyed by instance id and ip address
+type KnownHosts struct {
+	Path   string
+	Mode   HostKeyMode
+	Prompt func(question string) (bool, error)
+
+	mu sync.Mutex
+}
+
+// knownHostsLine : one line of the known_hosts file
+type knownHostsLine struct {
+	raw    string
+	marker string
+	hosts  []string
+	key    ssh.PublicKey
+	dirty  bool
+}
+
+// DefaultKnownHostsPath : return path of known_hosts managed by omssh, error if the home directory is unknown
+func DefaultKnownHostsPath(runtimeGOOS string) (string, error) {
+	home := os.Getenv("HOME")
+	if home == "" && runtimeGOOS == "windows" {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" {
+		return "", errors.New("cannot find known_hosts: HOME is not set, set it or --known-hosts")
+	}
+	return filepath.Join(home, ".omssh", "known_hosts"), nil
+}
+
+// NewKnownHosts : new known_hosts store
+func NewKnownHosts(path string, mode HostKeyMode) *KnownHosts {
+	return &KnownHosts{
+		Path:   path,
+		Mode:   mode,
+		Prompt: TerminalPrompt,
+	}
+}
+
+// HostKeyCallback : return callback verifying host keys of the instance
+func (k *KnownHosts) HostKeyCallback(instanceID string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return k.check(instanceID, hostname, key, nil)
+	}
+}
+
+// VerifiedHostKeyCallback : return callback verifying host keys of the instance
+// with fingerprints the instance printed to its console output, instead of trusting them on first use
+func (k *KnownHosts) VerifiedHostKeyCallback(instanceID string, fingerprints []string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if !matchFingerprints(fingerprints, key) {
+			return &HostKeyFingerprintError{
+				Host:         knownhosts.Normalize(hostname),
+				Received:     ssh.FingerprintSHA256(key),
+				Fingerprints: fingerprints,
+			}
+		}
+		return k.check(instanceID, hostname, key, fingerprints)
+	}
+}
+
+// HostKeyAlgorithms : key types recorded for the instance, or for the ip address of hostname if the instance has none,
+// for ssh.ClientConfig.HostKeyAlgorithms so that the server sends a known key. nil if the host is unknown.
+func (k *KnownHosts) HostKeyAlgorithms(instanceID, hostname string) ([]string, error) {
+	if k.Mode == HostKeyOff {
+		return nil, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	lines, err := k.load()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := knownhosts.Normalize(hostname)
+	var byInstance, byAddr []string
+	for _, l := range lines {
+		if l.marker != "" || l.key == nil {
+			continue
+		}
+		switch owner := instanceHost(l.hosts); {
+		case instanceID != "" && matchHosts(l.hosts, instanceID):
+			byInstance = appendKeyType(byInstance, l.key.Type())
+		case matchHosts(l.hosts, addr) && (owner == "" || owner == instanceID):
+			// lines of ip addresses reused by other instances are not known
+			byAddr = appendKeyType(byAddr, l.key.Type())
+		}
+	}
+	if len(byInstance) > 0 {
+		return byInstance, nil
+	}
+	return byAddr, nil
+}
+
+func appendKeyType(types []string, t string) []string {
+	for _, v := range types {
+		if v == t {
+			return types
+		}
+	}
+	return append(types, t)
+}
+
+func (k *KnownHosts) check(instanceID, hostname string, key ssh.PublicKey, fingerprints []string) error {
+	if k.Mode == HostKeyOff {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	lines, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	addr := knownhosts.Normalize(hostname)
+	display := addr
+	if instanceID != "" {
+		display = fmt.Sprintf("%s (%s)", instanceID, addr)
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	// hosts recorded under this instance id are authoritative
+	var known *knownHostsLine
+	for n, l := range lines {
+		if l.marker == "@revoked" && keyEqual(l.key, key) {
+			return fmt.Errorf("host key %s for %s is revoked in %s:%d", fingerprint, display, k.Path, n+1)
+		}
+		if l.marker != "" || instanceID == "" || !matchHosts(l.hosts, instanceID) {
+			continue
+		}
+		// hosts have a line of each key type, e.g. rsa, ecdsa and ed25519
+		if l.key.Type() != key.Type() {
+			continue
+		}
+		if !keyEqual(l.key, key) {
+			return &HostKeyMismatchError{
+				Host:     display,
+				Path:     k.Path,
+				Line:     n + 1,
+				Known:    ssh.FingerprintSHA256(l.key),
+				Received: fingerprint,
+			}
+		}
+		known = l
+	}
+
+	// the ip address may belong to an instance which was terminated
+	// and its public ip address reused by another one
+	var reused []string
+	for n, l := range lines {
+		if l.marker != "" || l == known || !matchHosts(l.hosts, addr) {
+			continue
+		}
+		if owner := instanceHost(l.hosts); owner != "" && owner != instanceID {
+			reused = append(reused, owner)
+			l.hosts = removeHost(l.hosts, addr)
+			l.dirty = true
+			continue
+		}
+		if l.key.Type() != key.Type() {
+			continue
+		}
+		if !keyEqual(l.key, key) {
+			return &HostKeyMismatchError{
+				Host:     display,
+				Path:     k.Path,
+				Line:     n + 1,
+				Known:    ssh.FingerprintSHA256(l.key),
+				Received: fingerprint,
+			}
+		}
+		if known == nil {
+			known = l
+		}
+	}
+
+	if known == nil {
+		// verified by fingerprints does not need trust on first use
+		if !matchFingerprints(fingerprints, key) {
+			if err := k.trustOnFirstUse(display, fingerprint, reused); err != nil {
+				return err
+			}
+		}
+		lines = append(lines, &knownHostsLine{hosts: knownHostsAddresses(instanceID, addr), key: key, dirty: true})
+	} else {
+		if instanceID != "" && !matchHosts(known.hosts, instanceID) {
+			known.hosts = append(known.hosts, instanceID)
+			known.dirty = true
+		}
+		if !matchHosts(known.hosts, addr) {
+			known.hosts = append(known.hosts, addr)
+			known.dirty = true
+		}
+		if !known.dirty && len(reused) == 0 {
+			return nil
+		}
+	}
+
+	return k.save(lines)
+}
+
+func (k *KnownHosts) trustOnFirstUse(display, fingerprint string, reused []string) error {
+	reason := ""
+	if len(reused) > 0 {
+		reason = fmt.Sprintf("the ip address was previously used by %s", strings.Join(reused, ", "))
+	}
+
+	switch k.Mode {
+	case HostKeyAcceptNew:
+		return nil
+	case HostKeyStrict:
+		if reason == "" {
+			reason = "strict host key checking is enabled"
+		}
+		return &HostKeyUnknownError{Host: display, Path: k.Path, Received: fingerprint, Reason: reason}
+	}
+
+	if k.Prompt == nil {
+		return &HostKeyUnknownError{Host: display, Path: k.Path, Received: fingerprint, Reason: "no way to confirm it"}
+	}
+
+	question := fmt.Sprintf("The authenticity of host %s can't be established.\n", display)
+	if reason != "" {
+		question += fmt.Sprintf("Note: %s.\n", reason)
+	}
+	question += fmt.Sprintf("Host key fingerprint is %s.\nAre you sure you want to continue connecting (yes/no)? ", fingerprint)
+
+	ok, err := k.Prompt(question)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &HostKeyUnknownError{Host: display, Path: k.Path, Received: fingerprint, Reason: "host key was not accepted"}
+	}
+	return nil
+}
+
+func (k *KnownHosts) load() (lines []*knownHostsLine, err error) {
+	f, err := os.Open(filepath.Clean(k.Path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for s.Scan() {
+		raw := s.Text()
+		l := &knownHostsLine{raw: raw}
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(raw))
+		switch {
+		case err == io.EOF:
+			// comment or blank line, kept as is
+		case err != nil:
+			return nil, fmt.Errorf("%s:%d: %v", k.Path, len(lines)+1, err)
+		default:
+			l.marker = marker
+			l.hosts = hosts
+			l.key = key
+		}
+		lines = append(lines, l)
+	}
+	return lines, s.Err()
+}
+
+func (k *KnownHosts) save(lines []*knownHostsLine) error {
+	dir := filepath.Dir(k.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		switch {
+		case !l.dirty:
+			buf.WriteString(l.raw)
+		case len(l.hosts) == 0:
+			// every address of the line was reused by other instances
+			continue
+		default:
+			buf.WriteString(formatKnownHostsLine(l))
+		}
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".known_hosts")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), k.Path)
+}
+
+func formatKnownHostsLine(l *knownHostsLine) string {
+	line := knownhosts.Line(l.hosts, l.key)
+	if l.marker != "" {
+		line = l.marker + " " + line
+	}
+	return line
+}
+
+// TerminalPrompt : ask yes/no question on the terminal, which is answered even if stdin is redirected like ssh
+func TerminalPrompt(question string) (bool, error) {
+	tty, err := os.Open(ttyPath)
+	if err != nil {
+		return false, fmt.Errorf("cannot confirm host key: %v", err)
+	}
+	defer func() {
+		// only read
+		_ = tty.Close()
+	}()
+	fmt.Fprint(os.Stderr, question)
+
+	r := bufio.NewReader(tty)
+	for {
+		answer, err := r.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "yes":
+			return true, nil
+		case "no":
+			return false, nil
+		}
+		fmt.Fprint(os.Stderr, "Please type 'yes' or 'no': ")
+	}
+}
+
+// matchFingerprints : whether the key has one of SHA256 or legacy MD5 fingerprints
+func matchFingerprints(fingerprints []string, key ssh.PublicKey) bool {
+	sha256 := ssh.FingerprintSHA256(key)
+	md5 := ssh.FingerprintLegacyMD5(key)
+	for _, f := range fingerprints {
+		if f == sha256 || strings.EqualFold(f, md5) {
+			return true
+		}
+	}
+	return false
+}
+
+func knownHostsAddresses(instanceID, addr string) []string {
+	if instanceID == "" {
+		return []string{addr}
+	}
+	return []string{instanceID, addr}
+}
+
+func keyEqual(a, b ssh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+// instanceHost : return instance id recorded in known_hosts hosts
+func instanceHost(hosts []string) string {
+	for _, h := range hosts {
+		if strings.HasPrefix(h, "i-") {
+			return h
+		}
+	}
+	return ""
+}
+
+func removeHost(hosts []string, host string) []string {
+	r := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if !matchHost(h, host) {
+			r = append(r, h)
+		}
+	}
+	return r
+}
+
+func matchHosts(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if matchHost(p[1:], host) {
+				return false
+			}
+			continue
+		}
+		if matchHost(p, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchHost : match a known_hosts host pattern, including hashed and wildcard patterns
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		return matchHashedHost(pattern, host)
+	}
+	if strings.ContainsAny(pattern, "*?") {
+		return wildcardMatch(pattern, host)
+	}
+	return pattern == host
+}
+
+func matchHashedHost(pattern, host string) bool {
+	f := strings.Split(pattern, "|")
+	if len(f) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(f[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(f[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	if _, err := mac.Write([]byte(host)); err != nil {
+		return false
+	}
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+func wildcardMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
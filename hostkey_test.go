@@ -0,0 +1,415 @@
+package omssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.PublicKey()
+}
+
+func newTestEd25519HostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func newTestKnownHosts(t *testing.T, mode HostKeyMode, content string) (*KnownHosts, func()) {
+	dir, err := ioutil.TempDir("", "omssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "known_hosts")
+	if content != "" {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k := NewKnownHosts(path, mode)
+	k.Prompt = func(string) (bool, error) {
+		t.Error("wrong result: \nprompt is called")
+		return false, nil
+	}
+	return k, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func readKnownHosts(t *testing.T, k *KnownHosts) string {
+	b, err := ioutil.ReadFile(k.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseHostKeyMode(t *testing.T) {
+	for s, expected := range map[string]HostKeyMode{
+		"":           HostKeyAsk,
+		"ask":        HostKeyAsk,
+		"strict":     HostKeyStrict,
+		"yes":        HostKeyStrict,
+		"accept-new": HostKeyAcceptNew,
+		"off":        HostKeyOff,
+		"no":         HostKeyOff,
+	} {
+		actual, err := ParseHostKeyMode(s)
+		if err != nil {
+			t.Error(err)
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("wrong result: %q\n%s", s, diff)
+		}
+	}
+
+	if _, err := ParseHostKeyMode("hoge"); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
+
+func TestDefaultKnownHostsPath(t *testing.T) {
+	home, userProfile := os.Getenv("HOME"), os.Getenv("USERPROFILE")
+	defer func() {
+		_ = os.Setenv("HOME", home)
+		_ = os.Setenv("USERPROFILE", userProfile)
+	}()
+
+	for _, testcase := range []struct {
+		name        string
+		home        string
+		userProfile string
+		goos        string
+		expected    string
+		isErr       bool
+	}{
+		{"home", "/home/kenzo", "", "linux", filepath.Join("/home/kenzo", ".omssh", "known_hosts"), false},
+		{"user profile on windows", "", `C:\Users\kenzo`, "windows", filepath.Join(`C:\Users\kenzo`, ".omssh", "known_hosts"), false},
+		{"no home", "", `C:\Users\kenzo`, "linux", "", true},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if err := os.Setenv("HOME", testcase.home); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Setenv("USERPROFILE", testcase.userProfile); err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := DefaultKnownHostsPath(testcase.goos)
+			if testcase.isErr {
+				if err == nil {
+					t.Errorf("wrong result: \nerr is nil, %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, path); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKnownHostsHostKeyCallback(t *testing.T) {
+	key := newTestHostKey(t)
+	otherKey := newTestHostKey(t)
+	ed25519Key := newTestEd25519HostKey(t)
+
+	for _, testcase := range []struct {
+		name string
+		call func(t *testing.T)
+	}{
+		{
+			"accept new host and record instance id and ip address",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyAcceptNew, "")
+				defer cleanup()
+
+				if err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				expected := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				if diff := cmp.Diff(expected, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"known host",
+			func(t *testing.T) {
+				content := "# comment\n" + knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, content)
+				defer cleanup()
+
+				if err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				if diff := cmp.Diff(content, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"known instance with new ip address",
+			func(t *testing.T) {
+				content := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, content)
+				defer cleanup()
+
+				if err := k.HostKeyCallback("i-aaaaaa")("12.34.56.09:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				expected := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01", "12.34.56.09"}, key) + "\n"
+				if diff := cmp.Diff(expected, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"unknown host in strict mode",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, "")
+				defer cleanup()
+
+				err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, key)
+				if _, ok := err.(*HostKeyUnknownError); !ok {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+			},
+		},
+		{
+			"changed host key of instance",
+			func(t *testing.T) {
+				content := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyAcceptNew, content)
+				defer cleanup()
+
+				err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, otherKey)
+				e, ok := err.(*HostKeyMismatchError)
+				if !ok {
+					t.Fatalf("wrong result: \n%#v", err)
+				}
+				if diff := cmp.Diff(1, e.Line); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				if diff := cmp.Diff(content, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"changed host key of ip address without instance id",
+			func(t *testing.T) {
+				content := knownhosts.Line([]string{"12.34.56.01"}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyAcceptNew, content)
+				defer cleanup()
+
+				err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, otherKey)
+				if _, ok := err.(*HostKeyMismatchError); !ok {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+			},
+		},
+		{
+			"other key types of instance and ip address",
+			func(t *testing.T) {
+				content := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, ed25519Key) + "\n" +
+					knownhosts.Line([]string{"12.34.56.01"}, ed25519Key) + "\n" +
+					knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, content)
+				defer cleanup()
+
+				if err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				if diff := cmp.Diff(content, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"ip address reused by new instance",
+			func(t *testing.T) {
+				content := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyAsk, content)
+				defer cleanup()
+
+				var question string
+				k.Prompt = func(q string) (bool, error) {
+					question = q
+					return true, nil
+				}
+
+				if err := k.HostKeyCallback("i-bbbbbb")("12.34.56.01:22", nil, otherKey); err != nil {
+					t.Error(err)
+				}
+				if !strings.Contains(question, "previously used by i-aaaaaa") {
+					t.Errorf("wrong result: \n%s", question)
+				}
+				expected := knownhosts.Line([]string{"i-aaaaaa"}, key) + "\n" +
+					knownhosts.Line([]string{"i-bbbbbb", "12.34.56.01"}, otherKey) + "\n"
+				if diff := cmp.Diff(expected, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"host key rejected on prompt",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyAsk, "")
+				defer cleanup()
+				k.Prompt = func(string) (bool, error) {
+					return false, nil
+				}
+
+				err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:2222", nil, key)
+				if _, ok := err.(*HostKeyUnknownError); !ok {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+				if _, err := os.Stat(k.Path); !os.IsNotExist(err) {
+					t.Error("wrong result: \nknown_hosts is written")
+				}
+			},
+		},
+		{
+			"hashed host",
+			func(t *testing.T) {
+				content := knownhosts.Line([]string{knownhosts.HashHostname("12.34.56.01")}, key) + "\n"
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, content)
+				defer cleanup()
+
+				if err := k.HostKeyCallback("")("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				if err := k.HostKeyCallback("")("12.34.56.01:22", nil, otherKey); err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+			},
+		},
+		{
+			"verified by console output fingerprints",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, "")
+				defer cleanup()
+
+				fingerprints := []string{ssh.FingerprintSHA256(otherKey), ssh.FingerprintSHA256(key)}
+				if err := k.VerifiedHostKeyCallback("i-aaaaaa", fingerprints)("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				expected := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n"
+				if diff := cmp.Diff(expected, readKnownHosts(t, k)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"verified by legacy md5 fingerprint",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyStrict, "")
+				defer cleanup()
+
+				fingerprints := []string{ssh.FingerprintLegacyMD5(key)}
+				if err := k.VerifiedHostKeyCallback("i-aaaaaa", fingerprints)("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+		{
+			"not in console output fingerprints",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyAcceptNew, "")
+				defer cleanup()
+
+				fingerprints := []string{ssh.FingerprintSHA256(otherKey)}
+				err := k.VerifiedHostKeyCallback("i-aaaaaa", fingerprints)("12.34.56.01:22", nil, key)
+				if _, ok := err.(*HostKeyFingerprintError); !ok {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+				if _, err := os.Stat(k.Path); !os.IsNotExist(err) {
+					t.Error("wrong result: \nknown_hosts is written")
+				}
+			},
+		},
+		{
+			"host key checking off",
+			func(t *testing.T) {
+				k, cleanup := newTestKnownHosts(t, HostKeyOff, "")
+				defer cleanup()
+
+				if err := k.HostKeyCallback("i-aaaaaa")("12.34.56.01:22", nil, key); err != nil {
+					t.Error(err)
+				}
+				if _, err := os.Stat(k.Path); !os.IsNotExist(err) {
+					t.Error("wrong result: \nknown_hosts is written")
+				}
+			},
+		},
+	} {
+		t.Run(testcase.name, testcase.call)
+	}
+}
+
+func TestKnownHostsHostKeyAlgorithms(t *testing.T) {
+	key := newTestHostKey(t)
+	ed25519Key := newTestEd25519HostKey(t)
+	content := knownhosts.Line([]string{"i-aaaaaa", "12.34.56.01"}, key) + "\n" +
+		knownhosts.Line([]string{"i-aaaaaa"}, ed25519Key) + "\n" +
+		knownhosts.Line([]string{"i-aaaaaa"}, ed25519Key) + "\n" +
+		knownhosts.Line([]string{"12.34.56.02"}, ed25519Key) + "\n" +
+		"@revoked " + knownhosts.Line([]string{"12.34.56.03"}, key) + "\n"
+
+	for _, testcase := range []struct {
+		name       string
+		instanceID string
+		hostname   string
+		expected   []string
+	}{
+		{"known instance", "i-aaaaaa", "12.34.56.09:22", []string{ssh.KeyAlgoECDSA256, ssh.KeyAlgoED25519}},
+		{"known ip address", "i-cccccc", "12.34.56.02:22", []string{ssh.KeyAlgoED25519}},
+		{"ip address reused by new instance", "i-bbbbbb", "12.34.56.01:22", nil},
+		{"revoked", "", "12.34.56.03:22", nil},
+		{"unknown host", "i-cccccc", "12.34.56.04:22", nil},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			k, cleanup := newTestKnownHosts(t, HostKeyStrict, content)
+			defer cleanup()
+
+			algorithms, err := k.HostKeyAlgorithms(testcase.instanceID, testcase.hostname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, algorithms); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
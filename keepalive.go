@@ -0,0 +1,241 @@
+package omssh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keepaliveRequest : global request which OpenSSH servers reply to, with failure
+const keepaliveRequest = "keepalive@openssh.com"
+
+// ConnectionLostError : error of the connection which is closed by the remote or not alive
+type ConnectionLostError struct {
+	Host string
+	Err  error
+}
+
+func (e *ConnectionLostError) Error() string {
+	return fmt.Sprintf("connection to %s lost: %v", e.Host, e.Err)
+}
+
+// IsConnectionLost : whether err is caused by the connection lost
+func IsConnectionLost(err error) bool {
+	_, ok := err.(*ConnectionLostError)
+	return ok
+}
+
+// WithKeepalive : send keepalive requests every interval, and close the connection
+// when countMax requests in a row are not replied, like ServerAliveInterval and ServerAliveCountMax of ssh
+func WithKeepalive(interval time.Duration, countMax int) Option {
+	return func(d *SSHDevice) {
+		d.keepaliveInterval = interval
+		d.keepaliveCountMax = countMax
+	}
+}
+
+// keepalive : send keepalive requests on client until it is closed
+func (d *SSHDevice) keepalive(client *ssh.Client, interval time.Duration, countMax int) {
+	if countMax <= 0 {
+		countMax = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for range ticker.C {
+		reply := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest(keepaliveRequest, true, nil)
+			reply <- err
+		}()
+
+		select {
+		case err := <-reply:
+			if err != nil {
+				// closed
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			missed++
+			if missed < countMax {
+				continue
+			}
+			d.mu.Lock()
+			d.lost = fmt.Errorf("no reply to %d keepalives", missed)
+			d.mu.Unlock()
+			_ = client.Close()
+			return
+		}
+	}
+}
+
+// connectionLost : error of the connection if it is lost, nil if alive
+func (d *SSHDevice) connectionLost() error {
+	d.mu.Lock()
+	lost := d.lost
+	d.mu.Unlock()
+	if lost != nil {
+		return &ConnectionLostError{Host: d.Host, Err: lost}
+	}
+
+	// the request fails only if the connection is closed
+	if _, _, err := d.client.SendRequest(keepaliveRequest, true, nil); err != nil {
+		return &ConnectionLostError{Host: d.Host, Err: err}
+	}
+	return nil
+}
+
+// Reconnector : starts a shell again on a new connection when the connection is lost
+type Reconnector struct {
+	// Connect : connect to the remote again,
+	// e.g. send the public key with ec2 instance connect before dialling as it expires
+	Connect     func() (Device, error)
+	MaxAttempts int
+	Interval    time.Duration
+	// Status : where reconnect attempts are shown
+	Status io.Writer
+}
+
+// StartShell : start the shell on device, and on new devices while the connection is lost.
+// Every device is closed when the shell exits.
+func (r *Reconnector) StartShell(device Device) error {
+	for {
+		err := device.StartShell()
+		// the remote may have already closed the connection
+		_ = device.Close()
+		if !IsConnectionLost(err) {
+			return err
+		}
+
+		device, err = r.reconnect(err)
+		if err != nil {
+			return err
+		}
+		device.SetupIO()
+	}
+}
+
+// reconnect : connect again at most MaxAttempts times
+func (r *Reconnector) reconnect(lost error) (Device, error) {
+	status := r.Status
+	if status == nil {
+		status = ioutil.Discard
+	}
+
+	err := lost
+	for attempt := 1; attempt <= r.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(r.Interval)
+		}
+		fmt.Fprintf(status, "%v, reconnecting (attempt %d/%d)\n", err, attempt, r.MaxAttempts)
+		var device Device
+		device, err = r.Connect()
+		if err == nil {
+			fmt.Fprintln(status, "reconnected")
+			return device, nil
+		}
+	}
+	return nil, lost
+}
+
+// ShellInput : input of shells one after another, e.g. on reconnect.
+// It is read by one goroutine, so the shell which has exited does not take the input of the next one.
+type ShellInput struct {
+	r    io.Reader
+	once sync.Once
+	// chunks : what is read from r, closed with err at the end
+	chunks chan []byte
+	err    error
+
+	mu sync.Mutex
+	// rest : chunk which the shell has not read to the end
+	rest []byte
+}
+
+// NewShellInput : new input of shells read from r, e.g. os.Stdin
+func NewShellInput(r io.Reader) *ShellInput {
+	return &ShellInput{r: r, chunks: make(chan []byte)}
+}
+
+// WithShellInput : take the input of the shell from in instead of stdin, which the shell stops reading when it exits
+func WithShellInput(in *ShellInput) Option {
+	return func(d *SSHDevice) {
+		d.shellInput = in
+	}
+}
+
+// read : read r until an error, which is started by the first shell
+func (in *ShellInput) read() {
+	for {
+		buf := make([]byte, 1024)
+		n, err := in.r.Read(buf)
+		if n > 0 {
+			in.chunks <- buf[:n]
+		}
+		if err != nil {
+			in.err = err
+			close(in.chunks)
+			return
+		}
+	}
+}
+
+// open : reader of a shell, which returns io.EOF once closed
+func (in *ShellInput) open() *shellInputReader {
+	in.once.Do(func() {
+		go in.read()
+	})
+	return &shellInputReader{in: in, closed: make(chan struct{})}
+}
+
+// shellInputReader : reader of ShellInput for a shell
+type shellInputReader struct {
+	in     *ShellInput
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (r *shellInputReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, io.EOF
+	default:
+	}
+
+	in := r.in
+	in.mu.Lock()
+	if len(in.rest) > 0 {
+		n := copy(p, in.rest)
+		in.rest = in.rest[n:]
+		in.mu.Unlock()
+		return n, nil
+	}
+	in.mu.Unlock()
+
+	select {
+	case <-r.closed:
+		return 0, io.EOF
+	case b, ok := <-in.chunks:
+		if !ok {
+			return 0, in.err
+		}
+		n := copy(p, b)
+		in.mu.Lock()
+		in.rest = b[n:]
+		in.mu.Unlock()
+		return n, nil
+	}
+}
+
+// close : stop reading, the input which is not read is left to the next shell
+func (r *shellInputReader) close() {
+	r.once.Do(func() {
+		close(r.closed)
+	})
+}
@@ -0,0 +1,279 @@
+package omssh
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
+)
+
+// freezableConn : connection which stops receiving when frozen, like a connection dropped by NAT gateways
+type freezableConn struct {
+	net.Conn
+	mu     sync.Mutex
+	frozen bool
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *freezableConn) freeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frozen = true
+}
+
+func (c *freezableConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	frozen := c.frozen
+	c.mu.Unlock()
+	if frozen {
+		<-c.closed
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (c *freezableConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// connectFreezable : connect to the test server through a connection which can be frozen
+func connectFreezable(t *testing.T, testPort string, opts ...Option) (Device, *freezableConn) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conn *freezableConn
+	dial := func(network, address string) (net.Conn, error) {
+		c, err := net.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		conn = &freezableConn{Conn: c, closed: make(chan struct{})}
+		return conn, nil
+	}
+	device := NewDevice("127.0.0.1", testPort, append(opts, WithDial(dial))...)
+	sshClientConfig := ConfigureSSHClient("testUser", signer, ssh.FixedHostKey(signer.PublicKey()))
+	if err := device.SSHConnect(sshClientConfig); err != nil {
+		t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+	}
+	return device, conn
+}
+
+func TestKeepalive(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	for _, testcase := range []struct {
+		name string
+		call func(t *testing.T)
+	}{
+		{
+			name: "alive",
+			call: func(t *testing.T) {
+				var stdout, stderr bytes.Buffer
+				device, _ := connectFreezable(t, testPort, WithKeepalive(10*time.Millisecond, 2), WithStdio(nil, &stdout, &stderr))
+				defer closeTestDevice(t, device)
+
+				time.Sleep(100 * time.Millisecond)
+				device.SetupIO()
+				if err := device.Run("echo hoge"); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("hoge\n", stdout.String()); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			name: "lost",
+			call: func(t *testing.T) {
+				device, conn := connectFreezable(t, testPort, WithKeepalive(10*time.Millisecond, 2))
+				conn.freeze()
+
+				done := make(chan error, 1)
+				go func() { done <- device.Wait() }()
+				select {
+				case err := <-done:
+					if !IsConnectionLost(err) {
+						t.Errorf("wrong result: \n%#v", err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("wrong result: \nconnection is not closed")
+				}
+			},
+		},
+	} {
+		t.Run(testcase.name, testcase.call)
+	}
+}
+
+func TestReconnector(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	for _, testcase := range []struct {
+		name string
+		call func(t *testing.T)
+	}{
+		{
+			name: "reconnected",
+			call: func(t *testing.T) {
+				var stdout, stderr, status bytes.Buffer
+				device, conn := connectFreezable(t, testPort, WithKeepalive(10*time.Millisecond, 2), WithStdio(nil, &stdout, &stderr))
+				conn.freeze()
+				device.SetupIO()
+
+				attempts := 0
+				r := &Reconnector{
+					Connect: func() (Device, error) {
+						attempts++
+						if attempts == 1 {
+							return nil, errors.New("public key is not sent")
+						}
+						d, _ := connectFreezable(t, testPort, WithStdio(nil, &stdout, &stderr))
+						return d, nil
+					},
+					MaxAttempts: 3,
+					Status:      &status,
+				}
+				if err := r.StartShell(device); err != nil {
+					t.Fatalf("wrong result: \n%#v", err)
+				}
+
+				if diff := cmp.Diff("hello\r\n", stdout.String()); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				lines := strings.Split(strings.TrimSpace(status.String()), "\n")
+				if len(lines) != 3 {
+					t.Fatalf("wrong result: \n%s", status.String())
+				}
+				for i, suffix := range []string{
+					"reconnecting (attempt 1/3)",
+					"public key is not sent, reconnecting (attempt 2/3)",
+					"reconnected",
+				} {
+					if !strings.HasSuffix(lines[i], suffix) {
+						t.Errorf("wrong result: \n%s", lines[i])
+					}
+				}
+			},
+		},
+		{
+			name: "gave up",
+			call: func(t *testing.T) {
+				device, conn := connectFreezable(t, testPort, WithKeepalive(10*time.Millisecond, 2), WithStdio(nil, &bytes.Buffer{}, &bytes.Buffer{}))
+				conn.freeze()
+				device.SetupIO()
+
+				attempts := 0
+				r := &Reconnector{
+					Connect: func() (Device, error) {
+						attempts++
+						return nil, errors.New("unreachable")
+					},
+					MaxAttempts: 2,
+				}
+				if err := r.StartShell(device); !IsConnectionLost(err) {
+					t.Errorf("wrong result: \n%#v", err)
+				}
+				if diff := cmp.Diff(2, attempts); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			name: "no wait after the last attempt",
+			call: func(t *testing.T) {
+				r := &Reconnector{
+					Connect: func() (Device, error) {
+						return nil, errors.New("unreachable")
+					},
+					MaxAttempts: 1,
+					Interval:    time.Hour,
+				}
+				done := make(chan error, 1)
+				go func() {
+					_, err := r.reconnect(&ConnectionLostError{Host: "localhost", Err: io.EOF})
+					done <- err
+				}()
+				select {
+				case err := <-done:
+					if !IsConnectionLost(err) {
+						t.Errorf("wrong result: \n%#v", err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("wrong result: \nwaiting after the last attempt")
+				}
+			},
+		},
+	} {
+		t.Run(testcase.name, testcase.call)
+	}
+}
+
+func TestShellInput(t *testing.T) {
+	r, w := io.Pipe()
+	in := NewShellInput(r)
+
+	// the shell which has lost the connection is still waiting for input
+	lost := in.open()
+	done := make(chan error, 1)
+	go func() {
+		_, err := lost.Read(make([]byte, 8))
+		done <- err
+	}()
+	lost.close()
+	if err := <-done; err != io.EOF {
+		t.Fatalf("wrong result: \n%#v", err)
+	}
+
+	go func() {
+		_, _ = w.Write([]byte("~.ls\r"))
+		_ = w.Close()
+	}()
+	next := in.open()
+	b := make([]byte, 3)
+	n, err := next.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.close()
+	if diff := cmp.Diff("~.l", string(b[:n])); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	// the input which is not read is left to the next shell
+	rest, err := ioutil.ReadAll(in.open())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("s\r", string(rest)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func closeTestDevice(t *testing.T, device Device) {
+	if err := device.Close(); err != nil {
+		t.Error(err)
+	}
+}
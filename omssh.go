@@ -1,16 +1,20 @@
 package omssh
 
 import (
-	"log"
+	"fmt"
+	"io"
 	"net"
 	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 var (
 	modes = ssh.TerminalModes{
-		ssh.ECHO:          0,
+		ssh.ECHO:          1,
 		ssh.TTY_OP_ISPEED: 14400,
 		ssh.TTY_OP_OSPEED: 14400,
 	}
@@ -21,6 +25,12 @@ type Device interface {
 	SSHConnect(config *ssh.ClientConfig) error
 	SetupIO()
 	StartShell() error
+	Run(cmd string) error
+	LocalForward(f Forward) error
+	RemoteForward(f Forward) error
+	DynamicForward(f Forward) error
+	Client() *ssh.Client
+	Wait() error
 	Close() error
 }
 
@@ -30,75 +40,294 @@ type SSHDevice struct {
 	Port    string
 	client  *ssh.Client
 	session *ssh.Session
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	mu       sync.Mutex
+	forwards []*forwarder
+
+	// dialer : opens the connection which ssh runs over, DirectDialer if nil
+	dialer Dialer
+	// jump : device which the connection is made through, closed with this device
+	jump Device
+	// agent : ssh agent forwarded to the remote, not forwarded if nil
+	agent agent.Agent
+
+	// keepaliveInterval : interval of keepalive requests, not sent if 0
+	keepaliveInterval time.Duration
+	keepaliveCountMax int
+	// lost : why the connection is considered lost by keepalive
+	lost error
+
+	// escapeChar : escape character of escape sequences in the shell, disabled if 0
+	escapeChar   byte
+	disconnected bool
+	// forwardOpened : called for port forwardings opened by ~C, nil if not told
+	forwardOpened func(kind string, f Forward, err error)
+	// shellInput : input of the shell shared with other devices, stdin is used if nil
+	shellInput *ShellInput
+
+	// recorder : records the shell, not recorded if nil
+	recorder Recorder
+}
+
+// Option : option of SSH device
+type Option func(*SSHDevice)
+
+// WithStdio : use stdin, stdout and stderr instead of os.Stdin, os.Stdout and os.Stderr.
+// nil stdin sends no input to the remote.
+func WithStdio(stdin io.Reader, stdout, stderr io.Writer) Option {
+	return func(d *SSHDevice) {
+		d.stdin = stdin
+		d.stdout = stdout
+		d.stderr = stderr
+	}
+}
+
+// WithDialer : open the connection which ssh runs over with dialer, e.g. through a proxy
+func WithDialer(dialer Dialer) Option {
+	return func(d *SSHDevice) {
+		d.dialer = dialer
+	}
+}
+
+// WithDial : open the connection which ssh runs over with dial, e.g. a tunnel of ec2 instance connect endpoint
+func WithDial(dial func(network, address string) (net.Conn, error)) Option {
+	return WithDialer(DialerFunc(dial))
+}
+
+// WithJump : connect through jump, e.g. a bastion in the vpc, which is closed with the device
+func WithJump(jump Device) Option {
+	return func(d *SSHDevice) {
+		d.dialer = &ProxyJumpDialer{Jump: jump}
+		d.jump = jump
+	}
 }
 
 // NewDevice : new SSH device
-func NewDevice(host, port string) Device {
-	return &SSHDevice{
-		Host: host,
-		Port: port,
+func NewDevice(host, port string, opts ...Option) Device {
+	d := &SSHDevice{
+		Host:       host,
+		Port:       port,
+		stdin:      os.Stdin,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		escapeChar: DefaultEscapeChar,
+	}
+	for _, opt := range opts {
+		opt(d)
 	}
+	return d
 }
 
 // ConfigureSSHClient : configure ssh client
-func ConfigureSSHClient(user string, signer ssh.Signer) *ssh.ClientConfig {
+func ConfigureSSHClient(user string, signer ssh.Signer, hostKeyCallback ssh.HostKeyCallback) *ssh.ClientConfig {
 	return &ssh.ClientConfig{
 		User: user,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 	}
 }
 
-// SSHConnect : ssh connect
+// SSHConnect : ssh connect.
+// The error is *NetworkError, *AuthError or *HostKeyError if the connection is refused.
 func (d *SSHDevice) SSHConnect(config *ssh.ClientConfig) error {
 	target := net.JoinHostPort(d.Host, d.Port)
-	client, err := ssh.Dial("tcp", target, config)
+	conn, err := d.dial(target, config)
 	if err != nil {
-		return err
+		return &NetworkError{Address: target, Err: err}
+	}
+	captured, hostKeyErr := capturingHostKeyCallback(config)
+	c, chans, reqs, err := ssh.NewClientConn(conn, target, captured)
+	if err != nil {
+		_ = conn.Close()
+		return handshakeError(target, config.User, err, *hostKeyErr)
 	}
+	client := ssh.NewClient(c, chans, reqs)
 	d.client = client
+	if d.keepaliveInterval > 0 {
+		go d.keepalive(client, d.keepaliveInterval, d.keepaliveCountMax)
+	}
 
 	session, err := client.NewSession()
 	if err != nil {
 		return err
 	}
 	d.session = session
-	return nil
+	return d.forwardAgent()
+}
+
+// dial : connect to target with the dialer
+func (d *SSHDevice) dial(target string, config *ssh.ClientConfig) (net.Conn, error) {
+	dialer := d.dialer
+	if dialer == nil {
+		dialer = &DirectDialer{Timeout: config.Timeout}
+	}
+	return dialer.Dial("tcp", target)
 }
 
 // SetupIO : set I/O
 func (d *SSHDevice) SetupIO() {
-	d.session.Stdout = os.Stdout
-	d.session.Stderr = os.Stderr
-	d.session.Stdin = os.Stdin
+	d.session.Stdout = d.stdout
+	d.session.Stderr = d.stderr
+	d.session.Stdin = d.stdin
 }
 
 // StartShell : requests a pseudo terminal and starts the remote shell.
-func (d *SSHDevice) StartShell() error {
+// The local terminal is in raw mode until the shell exits and its size changes are sent to the remote.
+// Escape sequences after a newline are taken from stdin unless the escape character is disabled.
+// If the connection is lost, the error is *ConnectionLostError.
+func (d *SSHDevice) StartShell() (err error) {
 	defer func() {
-		if err := d.session.Close(); err != nil {
-			log.Fatal(err)
+		if e := d.session.Close(); e != nil && e != io.EOF && err == nil {
+			err = e
 		}
+		err = d.shellError(err)
 	}()
 
-	if err := d.session.RequestPty(os.Getenv("TERM"), 25, 80, modes); err != nil {
+	inFd := fd(d.stdin)
+	outFd := fd(d.stdout)
+
+	term := os.Getenv("TERM")
+	if term == "" {
+		term = "xterm"
+	}
+	width, height := terminalSize(outFd)
+	if err := d.session.RequestPty(term, height, width, modes); err != nil {
+		return err
+	}
+
+	raw := &rawTerminal{fd: inFd}
+	if err := raw.makeRaw(); err != nil {
 		return err
 	}
+	defer raw.restore()
+
+	resize := func(w, h int) {
+		if d.recorder != nil {
+			d.recorder.Resize(w, h)
+		}
+		// resize is best effort, the session may be closing
+		_ = d.session.WindowChange(h, w)
+	}
+	stopWatching := watchTerminalSize(outFd, resize)
+	defer stopWatching()
+
+	if d.shellInput != nil {
+		// the session keeps reading stdin after the shell exits unless it is closed
+		stdin := d.shellInput.open()
+		defer stdin.close()
+		d.session.Stdin = stdin
+	}
+	if d.escapeChar != 0 && d.session.Stdin != nil {
+		d.session.Stdin = newEscapeFilter(d.session.Stdin, d.stderr, d.escapeChar, escapeActions{
+			disconnect: d.disconnect,
+			suspend: func() error {
+				raw.restore()
+				err := suspend()
+				if e := raw.makeRaw(); e != nil && err == nil {
+					err = e
+				}
+				// the terminal may have been resized while suspended
+				resize(terminalSize(outFd))
+				return err
+			},
+			forwards: d.forwardList,
+			command:  d.escapeCommand,
+		})
+	}
+	if d.recorder != nil {
+		d.record()
+	}
+
+	// restore the terminal before being terminated
+	stopHandling := onTermination(func() {
+		raw.restore()
+		_ = d.session.Close()
+	})
+	defer stopHandling()
 
 	if err := d.session.Shell(); err != nil {
 		return err
 	}
 
-	if err := d.session.Wait(); err != nil {
+	return d.session.Wait()
+}
+
+// record : record what is sent to and received from the shell, the pseudo terminal merges stderr into stdout
+func (d *SSHDevice) record() {
+	if d.session.Stdout != nil {
+		d.session.Stdout = &recordingWriter{w: d.session.Stdout, record: d.recorder.Output}
+	}
+	if d.session.Stderr != nil {
+		d.session.Stderr = &recordingWriter{w: d.session.Stderr, record: d.recorder.Output}
+	}
+	// input after escape sequences are taken
+	if d.session.Stdin != nil {
+		d.session.Stdin = &recordingReader{r: d.session.Stdin, record: d.recorder.Input}
+	}
+}
+
+// shellError : error of the shell, nil if disconnected by the escape sequence,
+// and *ConnectionLostError if the connection is lost
+func (d *SSHDevice) shellError(err error) error {
+	d.mu.Lock()
+	disconnected := d.disconnected
+	d.mu.Unlock()
+	if disconnected {
+		fmt.Fprintf(d.stderr, "Connection to %s closed.\n", d.Host)
+		return nil
+	}
+
+	if _, ok := err.(*ssh.ExitError); err == nil || ok {
 		return err
 	}
+	if lost := d.connectionLost(); lost != nil {
+		return lost
+	}
+	return err
+}
 
-	return nil
+// Run : runs cmd on the remote without a pseudo terminal.
+// If the command exits with non-zero status, the error is *ssh.ExitError.
+func (d *SSHDevice) Run(cmd string) (err error) {
+	defer func() {
+		if e := d.session.Close(); e != nil && e != io.EOF && err == nil {
+			err = e
+		}
+	}()
+
+	return d.session.Run(cmd)
+}
+
+// Client : ssh client of the connection, e.g. to open sftp subsystem
+func (d *SSHDevice) Client() *ssh.Client {
+	return d.client
 }
 
-// Close : close client
+// Wait : wait until the ssh connection is closed.
+// If keepalive requests are not replied, the error is *ConnectionLostError.
+func (d *SSHDevice) Wait() error {
+	err := d.client.Wait()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lost != nil {
+		return &ConnectionLostError{Host: d.Host, Err: d.lost}
+	}
+	return err
+}
+
+// Close : close port forwardings, client and the jump device
 func (d *SSHDevice) Close() error {
-	return d.client.Close()
+	d.closeForwards()
+	err := d.client.Close()
+	if d.jump != nil {
+		// the jump connection may have been closed by the remote
+		_ = d.jump.Close()
+	}
+	return err
 }
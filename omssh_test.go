@@ -1,16 +1,17 @@
 package omssh
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net"
-	"os"
-	"os/exec"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 const (
@@ -51,7 +52,7 @@ func TestConfigureSSHClient(t *testing.T) {
 		t.Error("wrong result : err is not nil")
 	}
 
-	sshClientConfig := ConfigureSSHClient(user, signer)
+	sshClientConfig := ConfigureSSHClient(user, signer, ssh.FixedHostKey(signer.PublicKey()))
 
 	if diff := cmp.Diff(sshClientConfig.User, user); diff != "" {
 		t.Errorf("wrong result :\n%s", diff)
@@ -83,23 +84,149 @@ func TestSSHConnect(t *testing.T) {
 
 	testPort := availablePort()
 
-	go buildSSHServer(signer, testPort)
+	buildSSHServer(signer, testPort)
 
 	user := "testUser"
 	device := NewDevice("localhost", testPort)
-	sshClientConfig := ConfigureSSHClient(user, signer)
+	sshClientConfig := ConfigureSSHClient(user, signer, ssh.FixedHostKey(signer.PublicKey()))
 	if err := device.SSHConnect(sshClientConfig); err != nil {
 		t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
 	}
 	device.SetupIO()
-	// if err := device.StartShell(); err != nil {
-	// 	t.Errorf("wrong result : err is not nil. \n%#v", err)
-	// }
+	if err := device.StartShell(); err != nil {
+		t.Errorf("wrong result : err is not nil. \n%#v", err)
+	}
 	if err := device.Close(); err != nil {
 		t.Errorf("wrong result : err is not nil. \n%#v", err)
 	}
 }
 
+func TestSSHConnectWithJump(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jump := connectTestSSHServer(t)
+
+	// the target is reached with the address seen from the jump host
+	targetPort := availablePort()
+	buildSSHServer(signer, targetPort)
+
+	var stdout, stderr bytes.Buffer
+	device := NewDevice("127.0.0.1", targetPort, WithJump(jump), WithStdio(nil, &stdout, &stderr))
+	sshClientConfig := ConfigureSSHClient("testUser", signer, ssh.FixedHostKey(signer.PublicKey()))
+	if err := device.SSHConnect(sshClientConfig); err != nil {
+		t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+	}
+	device.SetupIO()
+	if err := device.Run("echo hoge"); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff("hoge\n", stdout.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if err := device.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := jump.Client().NewSession(); err == nil {
+		t.Error("wrong result: \njump host is not closed")
+	}
+
+	unreachable := NewDevice("127.0.0.1", availablePort(), WithJump(connectTestSSHServer(t)))
+	if err := unreachable.SSHConnect(sshClientConfig); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
+
+func TestSSHConnectWithDial(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	// the private address is dialed through a tunnel, here a connection to the test server
+	var dialed string
+	dial := func(network, address string) (net.Conn, error) {
+		dialed = address
+		return net.Dial(network, net.JoinHostPort("127.0.0.1", testPort))
+	}
+
+	device := NewDevice("10.0.0.1", "22", WithDial(dial))
+	sshClientConfig := ConfigureSSHClient("testUser", signer, ssh.FixedHostKey(signer.PublicKey()))
+	if err := device.SSHConnect(sshClientConfig); err != nil {
+		t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+	}
+	if diff := cmp.Diff("10.0.0.1:22", dialed); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if err := device.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		t.Error("wrong result : err is not nil")
+	}
+
+	testPort := availablePort()
+	buildSSHServer(signer, testPort)
+
+	sshClientConfig := ConfigureSSHClient("testUser", signer, ssh.FixedHostKey(signer.PublicKey()))
+
+	for _, testcase := range []struct {
+		name           string
+		cmd            string
+		stdin          io.Reader
+		expectedStdout string
+		expectedStderr string
+		expectedStatus int
+	}{
+		{"stdout and stderr", "echo hoge", nil, "hoge\n", "hoge\n", 0},
+		{"piped stdin", "cat", strings.NewReader("moge\n"), "moge\n", "", 0},
+		{"exit status", "exit 3", nil, "", "", 3},
+		{"command not found", "foo", nil, "", "foo: command not found\n", 127},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			device := NewDevice("localhost", testPort, WithStdio(testcase.stdin, &stdout, &stderr))
+			if err := device.SSHConnect(sshClientConfig); err != nil {
+				t.Fatalf("wrong result : err is not nil. \n%s", err.Error())
+			}
+			defer func() {
+				if err := device.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			device.SetupIO()
+
+			status := 0
+			if err := device.Run(testcase.cmd); err != nil {
+				e, ok := err.(*ssh.ExitError)
+				if !ok {
+					t.Fatalf("wrong result : \n%#v", err)
+				}
+				status = e.ExitStatus()
+			}
+			if diff := cmp.Diff(testcase.expectedStatus, status); diff != "" {
+				t.Errorf("wrong result : \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.expectedStdout, stdout.String()); diff != "" {
+				t.Errorf("wrong result : \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.expectedStderr, stderr.String()); diff != "" {
+				t.Errorf("wrong result : \n%s", diff)
+			}
+		})
+	}
+}
+
 func buildSSHServer(signer ssh.Signer, testPort string) {
 	serverConfig := &ssh.ServerConfig{
 		NoClientAuth: true,
@@ -114,30 +241,122 @@ func buildSSHServer(signer ssh.Signer, testPort string) {
 	}
 	log.Printf("Listening on %s ...", testPort)
 
-	for {
-		tcpConn, err := listener.Accept()
-		if err != nil {
-			log.Fatalf("Failed to accept on %s (%s)", testPort, err)
+	go func() {
+		for {
+			tcpConn, err := listener.Accept()
+			if err != nil {
+				log.Fatalf("Failed to accept on %s (%s)", testPort, err)
+			}
+
+			sshConn, chans, reqs, err := ssh.NewServerConn(tcpConn, serverConfig)
+			if err != nil {
+				log.Printf("Failed to handshake (%s)", err)
+				continue
+			}
+			log.Printf("New SSH connection from %s (%s)", sshConn.RemoteAddr(), sshConn.ClientVersion())
+
+			go handleGlobalRequests(sshConn, reqs)
+			go handleChannels(sshConn, chans)
 		}
+	}()
+}
 
-		sshConn, chans, reqs, err := ssh.NewServerConn(tcpConn, serverConfig)
+// handleGlobalRequests : listen on the address requested by remote port forwarding
+func handleGlobalRequests(sshConn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := map[string]net.Listener{}
+	for req := range reqs {
+		var payload struct {
+			Addr string
+			Port uint32
+		}
+		if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" {
+			replyRequest(req, false)
+			continue
+		}
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			log.Fatalf("Failed to parse %s payload (%s)", req.Type, err)
+		}
+		address := net.JoinHostPort(payload.Addr, fmt.Sprint(payload.Port))
+
+		if req.Type == "cancel-tcpip-forward" {
+			if l, ok := listeners[address]; ok {
+				if err := l.Close(); err != nil {
+					log.Printf("Failed to close (%s)", err)
+				}
+				delete(listeners, address)
+			}
+			replyRequest(req, true)
+			continue
+		}
+
+		l, err := net.Listen("tcp", address)
 		if err != nil {
-			log.Fatalf("Failed to handshake (%s)", err)
+			replyRequest(req, false)
+			continue
+		}
+		listeners[address] = l
+		if err := req.Reply(true, ssh.Marshal(&struct{ Port uint32 }{payload.Port})); err != nil {
+			log.Printf("Failed to reply (%s)", err)
 		}
-		log.Printf("New SSH connection from %s (%s)", sshConn.RemoteAddr(), sshConn.ClientVersion())
 
-		go ssh.DiscardRequests(reqs)
-		go handleChannels(chans)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go forwardToClient(sshConn, conn, payload.Addr, payload.Port)
+			}
+		}()
 	}
 }
 
-func handleChannels(chans <-chan ssh.NewChannel) {
+func forwardToClient(sshConn *ssh.ServerConn, conn net.Conn, addr string, port uint32) {
+	remote := conn.RemoteAddr().(*net.TCPAddr)
+	payload := struct {
+		Addr       string
+		Port       uint32
+		OriginAddr string
+		OriginPort uint32
+	}{addr, port, remote.IP.String(), uint32(remote.Port)}
+
+	sshChannel, requests, err := sshConn.OpenChannel("forwarded-tcpip", ssh.Marshal(&payload))
+	if err != nil {
+		log.Printf("Failed to open channel (%s)", err)
+		if err := conn.Close(); err != nil {
+			log.Printf("Failed to close (%s)", err)
+		}
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		if _, err := io.Copy(sshChannel, conn); err != nil {
+			log.Printf("Failed to copy (%s)", err)
+		}
+		if err := sshChannel.CloseWrite(); err != nil {
+			log.Printf("Failed to close write (%s)", err)
+		}
+	}()
+	if _, err := io.Copy(conn, sshChannel); err != nil {
+		log.Printf("Failed to copy (%s)", err)
+	}
+	if err := conn.Close(); err != nil {
+		log.Printf("Failed to close (%s)", err)
+	}
+}
+
+func handleChannels(sshConn *ssh.ServerConn, chans <-chan ssh.NewChannel) {
 	for newChannel := range chans {
-		go handleChannel(newChannel)
+		go handleChannel(sshConn, newChannel)
 	}
 }
 
-func handleChannel(newChannel ssh.NewChannel) {
+func handleChannel(sshConn *ssh.ServerConn, newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() == "direct-tcpip" {
+		handleDirectTCPIP(newChannel)
+		return
+	}
 	if t := newChannel.ChannelType(); t != "session" {
 		if err := newChannel.Reject(ssh.UnknownChannelType, fmt.Sprintf("Unknown channel type: %s", t)); err != nil {
 			log.Fatal(err)
@@ -145,28 +364,171 @@ func handleChannel(newChannel ssh.NewChannel) {
 		return
 	}
 
-	sshChannel, _, err := newChannel.Accept()
+	sshChannel, requests, err := newChannel.Accept()
 	if err != nil {
 		log.Fatalf("Could not accept channel (%s)", err)
 		return
 	}
 
-	bash := exec.Command("bash")
+	agentForwarded := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req", "window-change", "env":
+			replyRequest(req, true)
+		case "auth-agent-req@openssh.com":
+			agentForwarded = true
+			replyRequest(req, true)
+		case "shell":
+			replyRequest(req, true)
+			if _, err := io.WriteString(sshChannel, "hello\r\n"); err != nil {
+				log.Printf("Failed to write (%s)", err)
+			}
+			exitSession(sshChannel, 0)
+			return
+		case "exec":
+			replyRequest(req, true)
+			var payload struct {
+				Command string
+			}
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				log.Fatalf("Failed to parse exec payload (%s)", err)
+			}
+			if payload.Command == "ssh-add -l" {
+				exitSession(sshChannel, listAgentKeys(sshConn, sshChannel, agentForwarded))
+				return
+			}
+			exitSession(sshChannel, execCommand(sshChannel, payload.Command))
+			return
+		default:
+			replyRequest(req, false)
+		}
+	}
+}
 
-	close := func() {
-		if e := sshChannel.Close(); e != nil {
-			log.Fatal(e)
+// listAgentKeys : list keys of the forwarded agent like ssh-add -l
+func listAgentKeys(sshConn *ssh.ServerConn, sshChannel ssh.Channel, agentForwarded bool) uint32 {
+	if !agentForwarded {
+		if _, err := io.WriteString(sshChannel.Stderr(), "Could not open a connection to your authentication agent.\n"); err != nil {
+			log.Printf("Failed to write (%s)", err)
 		}
-		_, e := bash.Process.Wait()
-		if e != nil {
-			log.Printf("Failed to exit bash (%s)", e)
+		return 2
+	}
+
+	agentChannel, requests, err := sshConn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		log.Printf("Failed to open agent channel (%s)", err)
+		return 2
+	}
+	go ssh.DiscardRequests(requests)
+	defer func() {
+		if err := agentChannel.Close(); err != nil {
+			log.Printf("Failed to close (%s)", err)
+		}
+	}()
+
+	keys, err := agent.NewClient(agentChannel).List()
+	if err != nil {
+		log.Printf("Failed to list keys (%s)", err)
+		return 2
+	}
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(sshChannel, "%s %s\n", ssh.FingerprintSHA256(k), k.Comment); err != nil {
+			log.Printf("Failed to write (%s)", err)
 		}
-		log.Printf("Session closed")
 	}
+	return 0
+}
 
-	bash.Stdout = os.Stdout
-	if err := bash.Run(); err != nil {
-		close()
+// handleDirectTCPIP : dial the address requested by local port forwarding
+func handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		log.Fatalf("Failed to parse direct-tcpip payload (%s)", err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+	if err != nil {
+		if err := newChannel.Reject(ssh.ConnectionFailed, err.Error()); err != nil {
+			log.Printf("Failed to reject (%s)", err)
+		}
+		return
+	}
+
+	sshChannel, requests, err := newChannel.Accept()
+	if err != nil {
+		log.Fatalf("Could not accept channel (%s)", err)
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		if _, err := io.Copy(sshChannel, conn); err != nil {
+			log.Printf("Failed to copy (%s)", err)
+		}
+		if err := sshChannel.CloseWrite(); err != nil {
+			log.Printf("Failed to close write (%s)", err)
+		}
+	}()
+	if _, err := io.Copy(conn, sshChannel); err != nil {
+		log.Printf("Failed to copy (%s)", err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		log.Printf("Failed to close write (%s)", err)
+	}
+}
+
+// execCommand : fake commands of the test server
+func execCommand(sshChannel ssh.Channel, cmd string) uint32 {
+	f := strings.Fields(cmd)
+	switch {
+	case len(f) == 2 && f[0] == "exit":
+		var status uint32
+		if _, err := fmt.Sscanf(f[1], "%d", &status); err != nil {
+			return 255
+		}
+		return status
+	case len(f) == 1 && f[0] == "cat":
+		if _, err := io.Copy(sshChannel, sshChannel); err != nil {
+			return 1
+		}
+		return 0
+	case len(f) > 1 && f[0] == "echo":
+		if _, err := fmt.Fprintln(sshChannel, strings.Join(f[1:], " ")); err != nil {
+			return 1
+		}
+		if _, err := fmt.Fprintln(sshChannel.Stderr(), strings.Join(f[1:], " ")); err != nil {
+			return 1
+		}
+		return 0
+	}
+	if _, err := fmt.Fprintf(sshChannel.Stderr(), "%s: command not found\n", cmd); err != nil {
+		log.Printf("Failed to write (%s)", err)
+	}
+	return 127
+}
+
+func replyRequest(req *ssh.Request, ok bool) {
+	if !req.WantReply {
 		return
 	}
+	if err := req.Reply(ok, nil); err != nil {
+		log.Printf("Failed to reply %s (%s)", req.Type, err)
+	}
+}
+
+func exitSession(sshChannel ssh.Channel, status uint32) {
+	msg := struct {
+		Status uint32
+	}{status}
+	if _, err := sshChannel.SendRequest("exit-status", false, ssh.Marshal(&msg)); err != nil {
+		log.Printf("Failed to send exit status (%s)", err)
+	}
+	if err := sshChannel.Close(); err != nil {
+		log.Printf("Failed to close channel (%s)", err)
+	}
+	log.Printf("Session closed")
 }
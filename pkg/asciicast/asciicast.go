@@ -0,0 +1,227 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Version : version of asciicast format
+const Version = 2
+
+// event types
+const (
+	Output = "o"
+	Input  = "i"
+	Resize = "r"
+)
+
+// Header : first line of asciicast v2 file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	// Metadata : where the session was recorded, which players ignore
+	Metadata *Metadata `json:"omssh,omitempty"`
+}
+
+// Metadata : ec2 instance and aws identity of the recorded session
+type Metadata struct {
+	InstanceID string `json:"instance_id"`
+	Profile    string `json:"profile"`
+	User       string `json:"user"`
+	Region     string `json:"region"`
+}
+
+// Event : line of asciicast v2 file, [time, type, data]
+type Event struct {
+	Time time.Duration
+	Type string
+	Data string
+}
+
+// MarshalJSON : encode as [time in seconds, type, data]
+func (e Event) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode([]interface{}{e.Time.Seconds(), e.Type, e.Data}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// UnmarshalJSON : decode [time in seconds, type, data]
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var v []interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if len(v) != 3 {
+		return fmt.Errorf("invalid event %s: [time, type, data]", b)
+	}
+	t, ok1 := v[0].(float64)
+	typ, ok2 := v[1].(string)
+	data, ok3 := v[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return fmt.Errorf("invalid event %s: [time, type, data]", b)
+	}
+	e.Time = time.Duration(t * float64(time.Second))
+	e.Type = typ
+	e.Data = data
+	return nil
+}
+
+// Writer : writes events of the session in asciicast v2 format, safe for concurrent use.
+// The first error is kept and returned by Close.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	enc   *json.Encoder
+	start time.Time
+	now   func() time.Time
+	err   error
+	// partial : incomplete utf-8 sequences at the end of the last data of each type
+	partial map[string][]byte
+}
+
+// NewWriter : write header to w and return the writer of events
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	return newWriter(w, header, time.Now)
+}
+
+func newWriter(w io.Writer, header Header, now func() time.Time) (*Writer, error) {
+	start := now()
+	header.Version = Version
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+	enc := json.NewEncoder(w)
+	// terminal output has a lot of escape sequences
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, enc: enc, start: start, now: now, partial: map[string][]byte{}}, nil
+}
+
+// Output : record output of the session
+func (w *Writer) Output(p []byte) {
+	w.writeText(Output, p)
+}
+
+// Input : record input to the session
+func (w *Writer) Input(p []byte) {
+	w.writeText(Input, p)
+}
+
+// Resize : record resize of the terminal
+func (w *Writer) Resize(width, height int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.write(Resize, fmt.Sprintf("%dx%d", width, height))
+}
+
+// writeText : write data of p, and keep an incomplete utf-8 sequence at the end until the next data
+func (w *Writer) writeText(typ string, p []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.partial[typ], p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	w.partial[typ] = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		w.write(typ, string(data[:cut]))
+	}
+}
+
+func (w *Writer) write(typ, data string) {
+	if w.err != nil {
+		return
+	}
+	w.err = w.enc.Encode(Event{Time: w.now().Sub(w.start), Type: typ, Data: data})
+}
+
+// Close : write the incomplete utf-8 sequences left with U+FFFD,
+// close the underlying writer if it is io.Closer, and return the first error
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, typ := range []string{Output, Input} {
+		if len(w.partial[typ]) > 0 {
+			// each invalid byte becomes U+FFFD
+			w.write(typ, string([]rune(string(w.partial[typ]))))
+			w.partial[typ] = nil
+		}
+	}
+	err := w.err
+	if c, ok := w.w.(io.Closer); ok {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Reader : reads asciicast v2 file
+type Reader struct {
+	Header Header
+	s      *bufio.Scanner
+}
+
+// NewReader : read header of asciicast v2 file from r
+func NewReader(r io.Reader) (*Reader, error) {
+	s := bufio.NewScanner(r)
+	// output of a full screen may be in one line
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("no asciicast header")
+	}
+
+	var header Header
+	if err := json.Unmarshal(s.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %v", err)
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+	return &Reader{Header: header, s: s}, nil
+}
+
+// Next : read next event, io.EOF at the end
+func (r *Reader) Next() (Event, error) {
+	for r.s.Scan() {
+		if len(r.s.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(r.s.Bytes(), &e); err != nil {
+			return Event{}, err
+		}
+		return e, nil
+	}
+	if err := r.s.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
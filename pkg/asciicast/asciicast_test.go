@@ -0,0 +1,185 @@
+package asciicast
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriter(t *testing.T) {
+	now := time.Unix(1570000000, 0)
+	clock := func() time.Time { return now }
+
+	var buf bytes.Buffer
+	w, err := newWriter(&buf, Header{
+		Width:  80,
+		Height: 24,
+		Metadata: &Metadata{
+			InstanceID: "i-1234567890",
+			Profile:    "prod",
+			User:       "ubuntu",
+			Region:     "ap-northeast-1",
+		},
+	}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	w.Output([]byte("hello\r\n"))
+	now = now.Add(time.Second)
+	w.Input([]byte("ls\r"))
+	w.Resize(100, 30)
+	// "あ" split in two writes is recorded at once
+	w.Output([]byte("\xe3\x81"))
+	now = now.Add(time.Second)
+	w.Output([]byte("\x82<"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"version":2,"width":80,"height":24,"timestamp":1570000000,"omssh":{"instance_id":"i-1234567890","profile":"prod","user":"ubuntu","region":"ap-northeast-1"}}
+[0.5,"o","hello\r\n"]
+[1.5,"i","ls\r"]
+[1.5,"r","100x30"]
+[2.5,"o","あ<"]
+`
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestWriterClosedInRune(t *testing.T) {
+	now := time.Unix(1570000000, 0)
+	var buf bytes.Buffer
+	w, err := newWriter(&buf, Header{Width: 80, Height: 24}, func() time.Time { return now })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the session ends in the middle of "あ"
+	w.Output([]byte("bye\xe3\x81"))
+	now = now.Add(time.Second)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"version":2,"width":80,"height":24,"timestamp":1570000000}
+[0,"o","bye"]
+` + "[1,\"o\",\"\ufffd\ufffd\"]\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestReader(t *testing.T) {
+	for _, testcase := range []struct {
+		name string
+		call func(t *testing.T)
+	}{
+		{
+			name: "events",
+			call: func(t *testing.T) {
+				r, err := NewReader(strings.NewReader(`{"version":2,"width":80,"height":24,"omssh":{"instance_id":"i-1234567890","profile":"prod","user":"ubuntu","region":"ap-northeast-1"}}
+[0.5,"o","hello\r\n"]
+
+[1.25,"r","100x30"]
+`))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("i-1234567890", r.Header.Metadata.InstanceID); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+
+				var events []Event
+				for {
+					e, err := r.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					events = append(events, e)
+				}
+				expected := []Event{
+					{Time: 500 * time.Millisecond, Type: Output, Data: "hello\r\n"},
+					{Time: 1250 * time.Millisecond, Type: Resize, Data: "100x30"},
+				}
+				if diff := cmp.Diff(expected, events); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			name: "unsupported version",
+			call: func(t *testing.T) {
+				if _, err := NewReader(strings.NewReader(`{"version":1,"width":80,"height":24,"stdout":[]}`)); err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+			},
+		},
+		{
+			name: "invalid event",
+			call: func(t *testing.T) {
+				r, err := NewReader(strings.NewReader("{\"version\":2,\"width\":80,\"height\":24}\n[0.5,\"o\"]\n"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := r.Next(); err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+			},
+		},
+	} {
+		t.Run(testcase.name, testcase.call)
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	recording := `{"version":2,"width":80,"height":24}
+[1.0,"o","a"]
+[1.5,"i","x"]
+[2.0,"o","b"]
+[12.0,"o","c"]
+`
+	for _, testcase := range []struct {
+		name          string
+		speed         float64
+		idleTimeLimit time.Duration
+		expected      []time.Duration
+	}{
+		{"normal speed", 1, 0, []time.Duration{time.Second, time.Second, 10 * time.Second}},
+		{"twice as fast", 2, 0, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond, 5 * time.Second}},
+		{"idle time limit", 1, 2 * time.Second, []time.Duration{time.Second, time.Second, 2 * time.Second}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(recording))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var slept []time.Duration
+			p := &Player{
+				Speed:         testcase.speed,
+				IdleTimeLimit: testcase.idleTimeLimit,
+				sleep:         func(d time.Duration) { slept = append(slept, d) },
+			}
+			var out bytes.Buffer
+			if err := p.Play(&out, r); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff("abc", out.String()); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.expected, slept); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
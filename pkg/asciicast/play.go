@@ -0,0 +1,54 @@
+package asciicast
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Player : plays output of asciicast v2 file back
+type Player struct {
+	// Speed : playback speed, 2 is twice as fast
+	Speed float64
+	// IdleTimeLimit : longest pause between events, no limit if 0
+	IdleTimeLimit time.Duration
+
+	sleep func(time.Duration)
+}
+
+// Play : write output events of r to w at their time
+func (p *Player) Play(w io.Writer, r *Reader) error {
+	if p.Speed <= 0 {
+		return errors.New("speed must be positive")
+	}
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	var last time.Duration
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.Type != Output {
+			continue
+		}
+
+		wait := e.Time - last
+		last = e.Time
+		if p.IdleTimeLimit > 0 && wait > p.IdleTimeLimit {
+			wait = p.IdleTimeLimit
+		}
+		if wait > 0 {
+			sleep(time.Duration(float64(wait) / p.Speed))
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// event types
+const (
+	ProfileSelected = "profile_selected"
+	KeyPushed       = "key_pushed"
+	KeyPushFailed   = "key_push_failed"
+	Connected       = "connected"
+	Disconnected    = "disconnected"
+	ForwardOpened   = "forward_opened"
+)
+
+// Identity : aws identity of the credentials, from sts get-caller-identity
+type Identity struct {
+	Account string `json:"account"`
+	Arn     string `json:"arn"`
+	UserID  string `json:"user_id"`
+}
+
+// Event : audit event, a line of JSON Lines
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	// LocalUser : user running omssh
+	LocalUser string    `json:"local_user,omitempty"`
+	Profile   string    `json:"profile,omitempty"`
+	Region    string    `json:"region,omitempty"`
+	Identity  *Identity `json:"identity,omitempty"`
+	// Account : aws account of ec2 instance, when it is not of the identity
+	Account string `json:"account,omitempty"`
+
+	InstanceID   string `json:"instance_id,omitempty"`
+	InstanceName string `json:"instance_name,omitempty"`
+	// User : os user on ec2 instance
+	User    string `json:"user,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Forward string `json:"forward,omitempty"`
+
+	// Duration : seconds from connect to disconnect
+	Duration   float64 `json:"duration,omitempty"`
+	ExitStatus *int    `json:"exit_status,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Sink : where events are written, e.g. a file, syslog or a webhook
+type Sink interface {
+	Write(e Event) error
+	Close() error
+}
+
+// Logger : writes events to every sink with who is connecting.
+// Methods of nil logger do nothing, so that auditing can be disabled.
+type Logger struct {
+	mu        sync.Mutex
+	sinks     []Sink
+	localUser string
+	profile   string
+	region    string
+	identity  *Identity
+	now       func() time.Time
+}
+
+// NewLogger : new logger of events by localUser, nil if there are no sinks
+func NewLogger(localUser string, sinks ...Sink) *Logger {
+	if len(sinks) == 0 {
+		return nil
+	}
+	return &Logger{sinks: sinks, localUser: localUser, now: time.Now}
+}
+
+// SetSession : set profile, region and aws identity of the events after the profile is selected
+func (l *Logger) SetSession(profile, region string, identity *Identity) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.profile = profile
+	l.region = region
+	l.identity = identity
+}
+
+// Log : write e with time and who is connecting to every sink.
+// Failures of sinks are logged and do not stop omssh.
+func (l *Logger) Log(e Event) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Time = l.now().UTC()
+	e.LocalUser = l.localUser
+	e.Profile = l.profile
+	if e.Region == "" {
+		// regions of the session if not of the ec2 instance
+		e.Region = l.region
+	}
+	e.Identity = l.identity
+	for _, s := range l.sinks {
+		if err := s.Write(e); err != nil {
+			log.Printf("audit log: %v\n", err)
+		}
+	}
+}
+
+// Close : close every sink
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	for _, s := range l.sinks {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ExitStatus : pointer to status, for Event.ExitStatus
+func ExitStatus(status int) *int {
+	return &status
+}
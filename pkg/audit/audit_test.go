@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// memorySink : keeps events
+type memorySink struct {
+	events []Event
+	err    error
+	closed bool
+}
+
+func (s *memorySink) Write(e Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestLogger(t *testing.T) {
+	now := time.Date(2019, 10, 1, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	sink := &memorySink{}
+	failing := &memorySink{err: errors.New("disk full")}
+	l := NewLogger("kenzo", sink, failing)
+	l.now = func() time.Time { return now }
+
+	l.Log(Event{Type: ProfileSelected})
+	identity := &Identity{Account: "123456789012", Arn: "arn:aws:iam::123456789012:user/kenzo", UserID: "AIDAXXXXXXXXXXXXXXXXX"}
+	l.SetSession("prod", "ap-northeast-1", identity)
+	l.Log(Event{Type: Disconnected, InstanceID: "i-1234567890", User: "ubuntu", Duration: 1.5, ExitStatus: ExitStatus(0)})
+	// region of the ec2 instance rather than of the session
+	l.Log(Event{Type: Connected, InstanceID: "i-0987654321", Region: "us-east-1", User: "ubuntu"})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{
+			Time:      now.UTC(),
+			Type:      ProfileSelected,
+			LocalUser: "kenzo",
+		},
+		{
+			Time:       now.UTC(),
+			Type:       Disconnected,
+			LocalUser:  "kenzo",
+			Profile:    "prod",
+			Region:     "ap-northeast-1",
+			Identity:   identity,
+			InstanceID: "i-1234567890",
+			User:       "ubuntu",
+			Duration:   1.5,
+			ExitStatus: ExitStatus(0),
+		},
+		{
+			Time:       now.UTC(),
+			Type:       Connected,
+			LocalUser:  "kenzo",
+			Profile:    "prod",
+			Region:     "us-east-1",
+			Identity:   identity,
+			InstanceID: "i-0987654321",
+			User:       "ubuntu",
+		},
+	}
+	if diff := cmp.Diff(expected, sink.events); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	// failure of a sink does not stop the others
+	if diff := cmp.Diff(expected, failing.events); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if !sink.closed || !failing.closed {
+		t.Error("wrong result: \nsinks are not closed")
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	l := NewLogger("kenzo")
+	if l != nil {
+		t.Fatalf("wrong result: \n%#v", l)
+	}
+	l.SetSession("prod", "ap-northeast-1", nil)
+	l.Log(Event{Type: ProfileSelected})
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ParseSink : parse where events are written,
+// a file path or file:///path, syslog for local syslog, syslog://host:port over udp,
+// syslog+tcp://host:port, or http(s):// url of a webhook which client posts events to
+func ParseSink(spec string, client *http.Client) (Sink, error) {
+	if spec == "syslog" {
+		return syslogSink("", "")
+	}
+	if !strings.Contains(spec, "://") {
+		return fileSink(spec)
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit log %q: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return fileSink(u.Path)
+	case "syslog":
+		return syslogSink("udp", u.Host)
+	case "syslog+tcp":
+		return syslogSink("tcp", u.Host)
+	case "http", "https":
+		return NewWebhookSink(spec, client), nil
+	}
+	return nil, fmt.Errorf("invalid audit log %q: file path, syslog or http(s) url", spec)
+}
+
+// fileSink : NewFileSink as Sink, which is nil on error
+func fileSink(path string) (Sink, error) {
+	s, err := NewFileSink(path)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// syslogSink : NewSyslogSink as Sink, which is nil on error
+func syslogSink(network, raddr string) (Sink, error) {
+	s, err := NewSyslogSink(network, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FileSink : appends events to a file in JSON Lines
+type FileSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileSink : open file of path to append events
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Write : append e as a line
+func (s *FileSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+// Close : close the file
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// WebhookSink : posts each event in JSON to url
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink : new sink posting to url with client, http.DefaultClient if nil
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookSink{url: url, client: client}
+}
+
+// Write : post e, which fails unless the response is 2xx
+func (s *WebhookSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the body is drained to reuse the connection
+		_, _ = ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("audit webhook %s: %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Close : nothing to close
+func (s *WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "omssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestParseSink(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	for _, testcase := range []struct {
+		spec     string
+		expected string
+		isErr    bool
+	}{
+		{filepath.Join(dir, "audit.log"), "FileSink", false},
+		{"file://" + filepath.Join(dir, "file.log"), "FileSink", false},
+		{"http://127.0.0.1:8080/audit", "WebhookSink", false},
+		{"https://audit.example.com/omssh", "WebhookSink", false},
+		{filepath.Join(dir, "no", "such", "dir.log"), "", true},
+		{"ftp://audit.example.com/", "", true},
+	} {
+		t.Run(testcase.spec, func(t *testing.T) {
+			s, err := ParseSink(testcase.spec, nil)
+			if testcase.isErr {
+				if err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+				if s != nil {
+					t.Errorf("wrong result: \n%#v", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+			if diff := cmp.Diff(testcase.expected, typeName(s)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func typeName(s Sink) string {
+	switch s.(type) {
+	case *FileSink:
+		return "FileSink"
+	case *WebhookSink:
+		return "WebhookSink"
+	}
+	return "unknown"
+}
+
+func TestFileSink(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "audit.log")
+
+	// events are appended to the existing file
+	for _, typ := range []string{Connected, Disconnected} {
+		s, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(Event{Time: time.Unix(0, 0).UTC(), Type: typ, InstanceID: "i-1234567890"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"time":"1970-01-01T00:00:00Z","type":"connected","instance_id":"i-1234567890"}
+{"time":"1970-01-01T00:00:00Z","type":"disconnected","instance_id":"i-1234567890"}
+`
+	if diff := cmp.Diff(expected, string(b)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []Event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		if diff := cmp.Diff("application/json", r.Header.Get("Content-Type")); diff != "" {
+			t.Errorf("wrong result: \n%s", diff)
+		}
+		received = append(received, e)
+		if e.Type == KeyPushFailed {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	s := NewWebhookSink(ts.URL, ts.Client())
+	if err := s.Write(Event{Type: KeyPushed, InstanceID: "i-1234567890"}); err != nil {
+		t.Error(err)
+	}
+	if err := s.Write(Event{Type: KeyPushFailed, InstanceID: "i-1234567890"}); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+	if diff := cmp.Diff(2, len(received)); diff != "" {
+		t.Fatalf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff(KeyPushed, received[0].Type); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
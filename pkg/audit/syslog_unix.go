@@ -0,0 +1,37 @@
+//go:build !windows
+// +build !windows
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogSink : writes events in JSON to syslog
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink : connect to syslog of raddr over network, local syslog if network is empty
+func NewSyslogSink(network, raddr string) (*SyslogSink, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_AUTH, "omssh")
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Write : write e as a message
+func (s *SyslogSink) Write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(b))
+}
+
+// Close : close the connection to syslog
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
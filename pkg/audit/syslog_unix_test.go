@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package audit
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	s, err := ParseSink("syslog://"+conn.LocalAddr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(Event{Type: Connected, InstanceID: "i-1234567890"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// priority of auth.info
+	message := string(b[:n])
+	if !strings.HasPrefix(message, "<38>") || !strings.Contains(message, `"type":"connected","instance_id":"i-1234567890"`) {
+		t.Errorf("wrong result: \n%s", message)
+	}
+}
@@ -0,0 +1,21 @@
+package audit
+
+import "errors"
+
+// SyslogSink : syslog is not available on windows
+type SyslogSink struct{}
+
+// NewSyslogSink : windows has no syslog
+func NewSyslogSink(network, raddr string) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
+
+// Write : nothing is written
+func (s *SyslogSink) Write(e Event) error {
+	return nil
+}
+
+// Close : nothing to close
+func (s *SyslogSink) Close() error {
+	return nil
+}
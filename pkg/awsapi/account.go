@@ -0,0 +1,112 @@
+package awsapi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+)
+
+// Account : aws account which ec2 instances are described in
+type Account struct {
+	ID string
+	// Alias : account alias, or name in the organization if it has no alias
+	Alias string
+}
+
+// RoleARN : arn of role in account, e.g. OrganizationAccountAccessRole created by aws organizations
+func RoleARN(accountID, role string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, role)
+}
+
+// OrganizationsIface : organizations interface
+type OrganizationsIface interface {
+	ListAccounts() ([]Account, error)
+}
+
+// OrganizationsInstance : organizations instance
+type OrganizationsInstance struct {
+	client organizationsiface.OrganizationsAPI
+}
+
+// NewOrganizationsClient : new organizations client
+func NewOrganizationsClient(svc organizationsiface.OrganizationsAPI) OrganizationsIface {
+	return &OrganizationsInstance{
+		client: svc,
+	}
+}
+
+// ListAccounts : active accounts in the organization with their names as aliases.
+// The error is *CredentialsError or *MFAError if caused by them.
+func (i *OrganizationsInstance) ListAccounts() ([]Account, error) {
+	var accounts []Account
+	err := i.client.ListAccountsPages(&organizations.ListAccountsInput{}, func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+		for _, a := range page.Accounts {
+			if aws.StringValue(a.Status) != organizations.AccountStatusActive {
+				continue
+			}
+			accounts = append(accounts, Account{
+				ID:    aws.StringValue(a.Id),
+				Alias: aws.StringValue(a.Name),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, classifyError(err, func(err error) error {
+			return fmt.Errorf("list accounts in the organization: %v", err)
+		})
+	}
+	return accounts, nil
+}
+
+// IAMIface : iam interface
+type IAMIface interface {
+	AccountAlias() (string, error)
+}
+
+// IAMInstance : iam instance
+type IAMInstance struct {
+	client iamiface.IAMAPI
+}
+
+// NewIAMClient : new iam client
+func NewIAMClient(svc iamiface.IAMAPI) IAMIface {
+	return &IAMInstance{
+		client: svc,
+	}
+}
+
+// AccountAlias : alias of the account, empty if it has none
+func (i *IAMInstance) AccountAlias() (string, error) {
+	res, err := i.client.ListAccountAliases(&iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+	// an account has one alias at most
+	if len(res.AccountAliases) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(res.AccountAliases[0]), nil
+}
+
+// AccountEC2InstanceConnect : ec2 instance connect clients of accounts, e.g. RegionalEC2InstanceConnect.
+// PushSSHPublicKey sends ssh public keys with the client of the account of ec2 instance.
+type AccountEC2InstanceConnect map[string]EC2InstanceConnectIface
+
+// SendSSHPubKey : send ssh public key with the client of the only account,
+// as the input does not tell the account of ec2 instance
+func (a AccountEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	if len(a) != 1 {
+		return false, errors.New("account of ec2 instance is unknown, send with PushSSHPublicKey")
+	}
+	for _, client := range a {
+		return client.SendSSHPubKey(p)
+	}
+	return false, nil
+}
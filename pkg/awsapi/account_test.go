@@ -0,0 +1,162 @@
+package awsapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/organizations"
+	"github.com/aws/aws-sdk-go/service/organizations/organizationsiface"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockOrganizationsiface struct {
+	organizationsiface.OrganizationsAPI
+
+	Pages []*organizations.ListAccountsOutput
+	Error error
+}
+
+func (m *mockOrganizationsiface) ListAccountsPages(input *organizations.ListAccountsInput, fn func(*organizations.ListAccountsOutput, bool) bool) error {
+	if m.Error != nil {
+		return m.Error
+	}
+	for n, p := range m.Pages {
+		if !fn(p, n == len(m.Pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestListAccounts(t *testing.T) {
+	m := NewOrganizationsClient(&mockOrganizationsiface{
+		Pages: []*organizations.ListAccountsOutput{
+			{
+				Accounts: []*organizations.Account{
+					{Id: aws.String("111111111111"), Name: aws.String("prod"), Status: aws.String(organizations.AccountStatusActive)},
+					{Id: aws.String("222222222222"), Name: aws.String("closed"), Status: aws.String(organizations.AccountStatusSuspended)},
+				},
+			},
+			{
+				Accounts: []*organizations.Account{
+					{Id: aws.String("333333333333"), Name: aws.String("stg"), Status: aws.String(organizations.AccountStatusActive)},
+				},
+			},
+		},
+	})
+	accounts, err := m.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Account{
+		{ID: "111111111111", Alias: "prod"},
+		{ID: "333333333333", Alias: "stg"},
+	}
+	if diff := cmp.Diff(expected, accounts); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	m = NewOrganizationsClient(&mockOrganizationsiface{Error: errors.New("error occured")})
+	if _, err := m.ListAccounts(); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
+
+type mockIAMiface struct {
+	iamiface.IAMAPI
+
+	Resp  iam.ListAccountAliasesOutput
+	Error error
+}
+
+func (m *mockIAMiface) ListAccountAliases(input *iam.ListAccountAliasesInput) (*iam.ListAccountAliasesOutput, error) {
+	return &m.Resp, m.Error
+}
+
+func TestAccountAlias(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		aliases  []string
+		expected string
+	}{
+		{"alias", []string{"kenzo-prod"}, "kenzo-prod"},
+		{"no alias", nil, ""},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			m := NewIAMClient(&mockIAMiface{
+				Resp: iam.ListAccountAliasesOutput{AccountAliases: aws.StringSlice(testcase.aliases)},
+			})
+			alias, err := m.AccountAlias()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, alias); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRoleARN(t *testing.T) {
+	actual := RoleARN("111111111111", "OrganizationAccountAccessRole")
+	if diff := cmp.Diff("arn:aws:iam::111111111111:role/OrganizationAccountAccessRole", actual); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestAccountEC2InstanceConnect(t *testing.T) {
+	prod := &regionEC2InstanceConnect{}
+	stg := &regionEC2InstanceConnect{}
+	client := AccountEC2InstanceConnect{
+		"111111111111": RegionalEC2InstanceConnect{"ap-northeast-1": prod},
+		"333333333333": RegionalEC2InstanceConnect{"ap-northeast-1": stg},
+	}
+
+	for _, e := range []EC2{
+		{InstanceID: "i-aaaaaa", AvailabilityZone: "ap-northeast-1a", Region: "ap-northeast-1", AccountID: "111111111111"},
+		{InstanceID: "i-bbbbbb", AvailabilityZone: "ap-northeast-1a", Region: "ap-northeast-1", AccountID: "333333333333"},
+	} {
+		if err := PushSSHPublicKey(client, e, "ubuntu", "ssh-ed25519 AAAA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff([]string{"i-aaaaaa"}, prod.sent); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"i-bbbbbb"}, stg.sent); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	err := PushSSHPublicKey(client, EC2{InstanceID: "i-cccccc", Region: "ap-northeast-1", AccountID: "222222222222"}, "ubuntu", "ssh-ed25519 AAAA")
+	if _, ok := err.(*KeyPushError); !ok {
+		t.Errorf("wrong result: \n%#v is not *KeyPushError", err)
+	}
+}
+
+func TestFinderLine(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		ec2      EC2
+		expected string
+	}{
+		{
+			name:     "selected profile",
+			ec2:      EC2{InstanceName: "web", InstanceID: "i-aaaaaa", InstanceType: "t2.micro"},
+			expected: "[web] i-aaaaaa (t2.micro)",
+		},
+		{
+			name:     "account and region",
+			ec2:      EC2{InstanceName: "web", InstanceID: "i-aaaaaa", InstanceType: "t2.micro", Region: "us-east-1", AccountID: "111111111111", AccountAlias: "prod"},
+			expected: "[web] i-aaaaaa (t2.micro) us-east-1 111111111111 prod",
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if diff := cmp.Diff(testcase.expected, finderLine(testcase.ec2)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
@@ -1,9 +1,16 @@
 package awsapi
 
 import (
+	"bufio"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	fuzzyfinder "github.com/ktr0731/go-fuzzyfinder"
@@ -12,31 +19,133 @@ import (
 // EC2Iface : ec2 interface
 type EC2Iface interface {
 	DescribeRunningEC2s() ([]EC2, error)
+	DescribeRegions() ([]string, error)
+	GetConsoleOutput(instanceID string) (string, error)
+	WaitUntilInstanceStatusOK(instanceIDs []string) error
 }
 
 // EC2Instance : ec2 instance
 type EC2Instance struct {
 	client ec2iface.EC2API
+	// region : region of the client, which described ec2 instances are in
+	region string
+	// account : account of the client, which described ec2 instances are in
+	account Account
+	// filters : ec2 api filters in addition to running instances
+	filters []*ec2.Filter
+
+	// progress : where how many ec2 instances are described is shown, not shown if nil
+	progress   io.Writer
+	maxRetries int
+	backoff    time.Duration
+	sleep      func(time.Duration)
+}
+
+const (
+	// describeMaxResults : ec2 instances in a page of DescribeInstances, the most allowed
+	describeMaxResults = 1000
+	// defaultDescribeRetries : retries of throttled DescribeInstances, in addition to those of aws sdk
+	defaultDescribeRetries = 5
+	defaultDescribeBackoff = time.Second
+)
+
+// EC2Option : option of ec2 client
+type EC2Option func(*EC2Instance)
+
+// WithProgress : show how many ec2 instances are described on w, e.g. a terminal
+func WithProgress(w io.Writer) EC2Option {
+	return func(i *EC2Instance) {
+		i.progress = w
+	}
+}
+
+// WithRegion : set region of the client to described ec2 instances
+func WithRegion(region string) EC2Option {
+	return func(i *EC2Instance) {
+		i.region = region
+	}
 }
 
-// EC2 : required ec2 instance information
+// WithAccount : set account of the client to described ec2 instances
+func WithAccount(account Account) EC2Option {
+	return func(i *EC2Instance) {
+		i.account = account
+	}
+}
+
+// WithRetry : retry throttled DescribeInstances from the failed page at most maxRetries times,
+// waiting backoff doubled every retry
+func WithRetry(maxRetries int, backoff time.Duration) EC2Option {
+	return func(i *EC2Instance) {
+		i.maxRetries = maxRetries
+		i.backoff = backoff
+	}
+}
+
+// BastionTag : tag of ec2 instances used as jump host to private instances in the same vpc
+const BastionTag = "omssh:bastion"
+
+// EC2 : ec2 instance information, which is serialised to json for other commands
 type EC2 struct {
-	InstanceID       string
-	PublicIPAddress  string
-	PrivateIPAddress string
-	InstanceType     string
-	InstanceName     string
-	AvailabilityZone string
+	InstanceID       string            `json:"instance_id"`
+	PublicIPAddress  string            `json:"public_ip_address,omitempty"`
+	PrivateIPAddress string            `json:"private_ip_address,omitempty"`
+	InstanceType     string            `json:"instance_type"`
+	InstanceName     string            `json:"instance_name,omitempty"`
+	AvailabilityZone string            `json:"availability_zone"`
+	Region           string            `json:"region,omitempty"`
+	AccountID        string            `json:"account_id,omitempty"`
+	AccountAlias     string            `json:"account_alias,omitempty"`
+	VpcID            string            `json:"vpc_id,omitempty"`
+	SubnetID         string            `json:"subnet_id,omitempty"`
+	Bastion          bool              `json:"bastion"`
+	Tags             map[string]string `json:"tags,omitempty"`
+
+	LaunchTime time.Time `json:"launch_time"`
+	ImageID    string    `json:"image_id,omitempty"`
+	// Platform : windows, or empty for linux/unix
+	Platform     string `json:"platform,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+	// Lifecycle : spot, scheduled or on-demand
+	Lifecycle          string          `json:"lifecycle"`
+	KeyName            string          `json:"key_name,omitempty"`
+	IAMInstanceProfile string          `json:"iam_instance_profile,omitempty"`
+	SecurityGroups     []SecurityGroup `json:"security_groups,omitempty"`
+	IPv6Addresses      []string        `json:"ipv6_addresses,omitempty"`
+	PublicDNSName      string          `json:"public_dns_name,omitempty"`
+	PrivateDNSName     string          `json:"private_dns_name,omitempty"`
+}
+
+// SecurityGroup : security group of ec2 instance
+type SecurityGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// lifecycleOnDemand : lifecycle of ec2 instances which are neither spot nor scheduled
+const lifecycleOnDemand = "on-demand"
+
+// Private : whether ec2 instance has no public ip address
+func (e EC2) Private() bool {
+	return e.PublicIPAddress == ""
 }
 
 // NewEC2Client : new ec2 client
-func NewEC2Client(svc ec2iface.EC2API) EC2Iface {
-	return &EC2Instance{
-		client: svc,
+func NewEC2Client(svc ec2iface.EC2API, opts ...EC2Option) EC2Iface {
+	i := &EC2Instance{
+		client:     svc,
+		maxRetries: defaultDescribeRetries,
+		backoff:    defaultDescribeBackoff,
+		sleep:      time.Sleep,
 	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
 }
 
-// DescribeRunningEC2s : get list of running ec2 instances
+// DescribeRunningEC2s : get list of running ec2 instances in every page of DescribeInstances.
+// The error is *DescribeError, or *CredentialsError or *MFAError caused by them.
 func (i *EC2Instance) DescribeRunningEC2s() ([]EC2, error) {
 	// condition: running instance only
 	input := &ec2.DescribeInstancesInput{
@@ -48,86 +157,265 @@ func (i *EC2Instance) DescribeRunningEC2s() ([]EC2, error) {
 				},
 			},
 		},
+		MaxResults: aws.Int64(describeMaxResults),
 	}
+	input.Filters = append(input.Filters, i.filters...)
 
-	res, err := i.client.DescribeInstances(input)
-	if err != nil {
-		return nil, err
+	e := []EC2{}
+	pages := 0
+	retries := 0
+	defer i.finishProgress()
+	for {
+		err := i.client.DescribeInstancesPages(input, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			pages++
+			for _, r := range page.Reservations {
+				for _, instance := range r.Instances {
+					ec2 := newEC2(instance)
+					ec2.Region = i.region
+					ec2.AccountID = i.account.ID
+					ec2.AccountAlias = i.account.Alias
+					e = append(e, ec2)
+				}
+			}
+			i.showProgress(len(e), pages)
+
+			// retried from the next page if it is throttled
+			input.NextToken = page.NextToken
+			retries = 0
+			return true
+		})
+		if err == nil {
+			return e, nil
+		}
+		if !request.IsErrorThrottle(err) || retries >= i.maxRetries {
+			return nil, classifyError(err, func(err error) error {
+				return &DescribeError{Region: i.region, Account: i.account.ID, Err: err}
+			})
+		}
+		i.sleep(i.backoff << uint(retries))
+		retries++
 	}
+}
 
-	e := []EC2{}
-	for _, r := range res.Reservations {
-		for _, i := range r.Instances {
+// newEC2 : required information of ec2 instance
+func newEC2(i *ec2.Instance) EC2 {
+	// tag:Name and tag:omssh:bastion
+	name := ""
+	bastion := false
+	tags := map[string]string{}
+	for _, t := range i.Tags {
+		tags[*t.Key] = aws.StringValue(t.Value)
+		switch *t.Key {
+		case "Name":
+			name = *t.Value
+		case BastionTag:
+			bastion = strings.EqualFold(*t.Value, "true")
+		}
+	}
 
-			// public ip address
-			if i.PublicIpAddress == nil {
-				continue
-			}
-			publicIPAddress := *i.PublicIpAddress
+	// private ip address
+	privateIPAddress := ""
+	if i.PrivateIpAddress != nil {
+		privateIPAddress = *i.PrivateIpAddress
+	}
 
-			// tag:Name
-			name := ""
-			for _, t := range i.Tags {
-				if *t.Key == "Name" {
-					name = *t.Value
-				}
-			}
+	lifecycle := aws.StringValue(i.InstanceLifecycle)
+	if lifecycle == "" {
+		lifecycle = lifecycleOnDemand
+	}
 
-			// private ip address
-			privateIPAddress := ""
-			if i.PrivateIpAddress != nil {
-				privateIPAddress = *i.PrivateIpAddress
-			}
+	iamInstanceProfile := ""
+	if i.IamInstanceProfile != nil {
+		iamInstanceProfile = aws.StringValue(i.IamInstanceProfile.Arn)
+	}
 
-			e = append(e, EC2{
-				InstanceID:       *i.InstanceId,
-				InstanceType:     *i.InstanceType,
-				PublicIPAddress:  publicIPAddress,
-				PrivateIPAddress: privateIPAddress,
-				InstanceName:     name,
-				AvailabilityZone: *i.Placement.AvailabilityZone,
-			})
+	var securityGroups []SecurityGroup
+	for _, g := range i.SecurityGroups {
+		securityGroups = append(securityGroups, SecurityGroup{
+			ID:   aws.StringValue(g.GroupId),
+			Name: aws.StringValue(g.GroupName),
+		})
+	}
+
+	var ipv6Addresses []string
+	for _, n := range i.NetworkInterfaces {
+		for _, a := range n.Ipv6Addresses {
+			ipv6Addresses = append(ipv6Addresses, aws.StringValue(a.Ipv6Address))
+		}
+	}
+
+	return EC2{
+		InstanceID:         *i.InstanceId,
+		InstanceType:       *i.InstanceType,
+		PublicIPAddress:    aws.StringValue(i.PublicIpAddress),
+		PrivateIPAddress:   privateIPAddress,
+		InstanceName:       name,
+		AvailabilityZone:   *i.Placement.AvailabilityZone,
+		VpcID:              aws.StringValue(i.VpcId),
+		SubnetID:           aws.StringValue(i.SubnetId),
+		Bastion:            bastion,
+		Tags:               tags,
+		LaunchTime:         aws.TimeValue(i.LaunchTime),
+		ImageID:            aws.StringValue(i.ImageId),
+		Platform:           aws.StringValue(i.Platform),
+		Architecture:       aws.StringValue(i.Architecture),
+		Lifecycle:          lifecycle,
+		KeyName:            aws.StringValue(i.KeyName),
+		IAMInstanceProfile: iamInstanceProfile,
+		SecurityGroups:     securityGroups,
+		IPv6Addresses:      ipv6Addresses,
+		PublicDNSName:      aws.StringValue(i.PublicDnsName),
+		PrivateDNSName:     aws.StringValue(i.PrivateDnsName),
+	}
+}
+
+// showProgress : show how many ec2 instances are described so far
+func (i *EC2Instance) showProgress(instances, pages int) {
+	if i.progress == nil {
+		return
+	}
+	in := ""
+	if i.region != "" {
+		in = " in " + i.region
+	}
+	if i.account.ID != "" {
+		in += " of " + i.account.ID
+	}
+	fmt.Fprintf(i.progress, "\rdescribing ec2 instances%s: %d instances in %d pages", in, instances, pages)
+}
+
+// finishProgress : end the line of progress
+func (i *EC2Instance) finishProgress() {
+	if i.progress == nil {
+		return
+	}
+	fmt.Fprintln(i.progress)
+}
+
+// DescribeRegions : names of regions enabled in the account.
+// The error is *DescribeError, or *CredentialsError or *MFAError caused by them.
+func (i *EC2Instance) DescribeRegions() ([]string, error) {
+	res, err := i.client.DescribeRegions(&ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, classifyError(err, func(err error) error {
+			return &DescribeError{Region: i.region, Account: i.account.ID, Err: err}
+		})
+	}
+
+	regions := make([]string, 0, len(res.Regions))
+	for _, r := range res.Regions {
+		regions = append(regions, aws.StringValue(r.RegionName))
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// FindBastion : find ec2 instance tagged as bastion with public ip address in the vpc of target
+func FindBastion(ec2s []EC2, target EC2) (EC2, bool) {
+	for _, e := range ec2s {
+		if e.Bastion && !e.Private() && e.VpcID == target.VpcID && e.InstanceID != target.InstanceID {
+			return e, true
 		}
 	}
+	return EC2{}, false
+}
+
+// GetConsoleOutput : get decoded console output of ec2 instance
+func (i *EC2Instance) GetConsoleOutput(instanceID string) (string, error) {
+	res, err := i.client.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+	})
+	if err != nil {
+		return "", err
+	}
+	if res.Output == nil {
+		return "", nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(*res.Output)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// WaitUntilInstanceStatusOK : wait until status checks of ec2 instances pass
+func (i *EC2Instance) WaitUntilInstanceStatusOK(instanceIDs []string) error {
+	return i.client.WaitUntilInstanceStatusOk(&ec2.DescribeInstanceStatusInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+}
 
-	return e, nil
+// ParseHostKeyFingerprints : parse ssh host key fingerprints printed to console output on boot
+func ParseHostKeyFingerprints(output string) []string {
+	const (
+		begin = "-----BEGIN SSH HOST KEY FINGERPRINTS-----"
+		end   = "-----END SSH HOST KEY FINGERPRINTS-----"
+	)
+
+	var fingerprints []string
+	inBlock := false
+	s := bufio.NewScanner(strings.NewReader(output))
+	for s.Scan() {
+		l := s.Text()
+		switch {
+		case strings.Contains(l, begin):
+			// the latest boot wins
+			inBlock = true
+			fingerprints = nil
+		case strings.Contains(l, end):
+			inBlock = false
+		case inBlock:
+			// e.g. "ec2: 256 SHA256:xxxx root@ip-10-0-0-1 (ECDSA)"
+			for _, f := range strings.Fields(l) {
+				f = strings.TrimPrefix(f, "MD5:")
+				if strings.HasPrefix(f, "SHA256:") || strings.Count(f, ":") == 15 {
+					fingerprints = append(fingerprints, f)
+					break
+				}
+			}
+		}
+	}
+	return fingerprints
 }
 
-// FinderEC2 : find information of ec2 instance through fuzzyfinder
-func FinderEC2(ec2List []EC2) (ec2 EC2, err error) {
+// FinderEC2 : find information of ec2 instances through fuzzyfinder, several instances can be selected by tab
+func FinderEC2(ec2List []EC2) (ec2s []EC2, err error) {
 	idx, err := fuzzyfinder.FindMulti(
 		ec2List,
 		func(i int) string {
-			return fmt.Sprintf("[%s] %s (%s)",
-				ec2List[i].InstanceName,
-				ec2List[i].InstanceID,
-				ec2List[i].InstanceType,
-			)
+			return finderLine(ec2List[i])
 		},
 		fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
 			if i == -1 {
 				return ""
 			}
-			return fmt.Sprintf(
-				"InstanceID: %s\ntag:Name: %s \nInstanceType: %s\nPublicIP: %s\nPrivateIP: %s",
-				ec2List[i].InstanceID,
-				ec2List[i].InstanceName,
-				ec2List[i].InstanceType,
-				ec2List[i].PublicIPAddress,
-				ec2List[i].PrivateIPAddress,
-			)
+			return previewEC2(ec2List[i], w, h)
 		}),
 	)
 
 	if err != nil {
-		return ec2, err
+		return nil, err
 	}
 
+	// keep order of the list
+	sort.Ints(idx)
 	for _, i := range idx {
-		ec2 = ec2List[i]
+		ec2s = append(ec2s, ec2List[i])
 	}
 
-	return ec2, nil
+	return ec2s, nil
+}
+
+// finderLine : line of ec2 instance in the finder, with region and account columns if described in them
+func finderLine(e EC2) string {
+	line := fmt.Sprintf("[%s] %s (%s)", e.InstanceName, e.InstanceID, e.InstanceType)
+	for _, column := range []string{e.Region, e.AccountID, e.AccountAlias} {
+		if column != "" {
+			line += " " + column
+		}
+	}
+	return line
 }
 
 // FinderUsername : find ssh username through fuzzyfinder
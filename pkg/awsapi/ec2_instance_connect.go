@@ -1,10 +1,18 @@
 package awsapi
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
 	"github.com/aws/aws-sdk-go/service/ec2instanceconnect/ec2instanceconnectiface"
 )
 
+// PublicKeyLifetime : how long ec2 instance connect keeps the sent public key on ec2 instance
+const PublicKeyLifetime = 60 * time.Second
+
 // EC2InstanceConnectIface : ec2 instance connect interface
 type EC2InstanceConnectIface interface {
 	SendSSHPubKey(ec2instanceconnect.SendSSHPublicKeyInput) (bool, error)
@@ -30,3 +38,55 @@ func (i *EC2InstanceConnectInstance) SendSSHPubKey(p ec2instanceconnect.SendSSHP
 	}
 	return *r.Success, nil
 }
+
+// PushSSHPublicKey : send ssh public key of user to ec2 instance,
+// with the client of the account and the region of ec2 instance if client is AccountEC2InstanceConnect or RegionalEC2InstanceConnect.
+// The error is *KeyPushError, or *CredentialsError or *MFAError caused by them.
+func PushSSHPublicKey(client EC2InstanceConnectIface, ec2 EC2, user, publicKey string) error {
+	input := ec2instanceconnect.SendSSHPublicKeyInput{
+		AvailabilityZone: aws.String(ec2.AvailabilityZone),
+		InstanceId:       aws.String(ec2.InstanceID),
+		InstanceOSUser:   aws.String(user),
+		SSHPublicKey:     aws.String(publicKey),
+	}
+
+	client, err := clientOf(client, ec2)
+	if err != nil {
+		return &KeyPushError{InstanceID: ec2.InstanceID, Err: err}
+	}
+
+	r, err := client.SendSSHPubKey(input)
+	if err != nil {
+		return classifyError(err, func(err error) error {
+			return &KeyPushError{InstanceID: ec2.InstanceID, Err: err}
+		})
+	}
+	if !r {
+		return &KeyPushError{InstanceID: ec2.InstanceID, Err: errors.New("not sent")}
+	}
+	return nil
+}
+
+// clientOf : ec2 instance connect client of the account and the region of ec2 instance
+func clientOf(client EC2InstanceConnectIface, ec2 EC2) (EC2InstanceConnectIface, error) {
+	for {
+		switch c := client.(type) {
+		case AccountEC2InstanceConnect:
+			var ok bool
+			if client, ok = c[ec2.AccountID]; !ok {
+				return nil, fmt.Errorf("no ec2 instance connect client of account %s", ec2.AccountID)
+			}
+		case RegionalEC2InstanceConnect:
+			if ec2.Region == "" {
+				// chosen by the availability zone
+				return client, nil
+			}
+			var ok bool
+			if client, ok = c[ec2.Region]; !ok {
+				return nil, fmt.Errorf("no ec2 instance connect client in %s", ec2.Region)
+			}
+		default:
+			return client, nil
+		}
+	}
+}
@@ -54,3 +54,30 @@ func TestSendSSHPubKeyWithError(t *testing.T) {
 		t.Errorf("wrong result \n%s", diff)
 	}
 }
+
+func TestPushSSHPublicKey(t *testing.T) {
+	for _, testcase := range []struct {
+		name    string
+		success bool
+		err     error
+		isError bool
+	}{
+		{"success", true, nil, false},
+		{"not success", false, nil, true},
+		{"error", false, errors.New("error occured"), true},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			m := NewEC2InstanceConnectClient(&mockEC2InstanceConnectiface{
+				Resp: ec2instanceconnect.SendSSHPublicKeyOutput{
+					RequestId: aws.String("1234567890"),
+					Success:   aws.Bool(testcase.success),
+				},
+				Error: testcase.err,
+			})
+			err := PushSSHPublicKey(m, testEC2s[0], "ubuntu", "ssh-rsa AAAA")
+			if diff := cmp.Diff(testcase.isError, err != nil); diff != "" {
+				t.Errorf("wrong result \n%s", diff)
+			}
+		})
+	}
+}
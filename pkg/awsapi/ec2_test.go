@@ -1,10 +1,18 @@
 package awsapi
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/google/go-cmp/cmp"
@@ -37,14 +45,40 @@ var (
 type mockEC2Client struct {
 	ec2iface.EC2API
 
-	Resp  ec2.DescribeInstancesOutput
-	Error error
+	Resp              ec2.DescribeInstancesOutput
+	ConsoleOutputResp ec2.GetConsoleOutputOutput
+	RegionsResp       ec2.DescribeRegionsOutput
+	Error             error
+
+	// Input : input of the last DescribeInstancesPages
+	Input *ec2.DescribeInstancesInput
+}
+
+func (m *mockEC2Client) DescribeRegions(input *ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
+	return &m.RegionsResp, m.Error
 }
 
 func (m *mockEC2Client) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
 	return &m.Resp, m.Error
 }
 
+func (m *mockEC2Client) DescribeInstancesPages(input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
+	m.Input = input
+	if m.Error != nil {
+		return m.Error
+	}
+	fn(&m.Resp, true)
+	return nil
+}
+
+func (m *mockEC2Client) WaitUntilInstanceStatusOk(input *ec2.DescribeInstanceStatusInput) error {
+	return m.Error
+}
+
+func (m *mockEC2Client) GetConsoleOutput(input *ec2.GetConsoleOutputInput) (*ec2.GetConsoleOutputOutput, error) {
+	return &m.ConsoleOutputResp, m.Error
+}
+
 func TestDescribeRunningEC2s(t *testing.T) {
 	m := NewEC2Client(&mockEC2Client{
 		Error: nil,
@@ -57,6 +91,7 @@ func TestDescribeRunningEC2s(t *testing.T) {
 							InstanceType:     aws.String("t3.micro"),
 							PublicIpAddress:  aws.String("12.34.56.01"),
 							PrivateIpAddress: aws.String("192.168.10.1"),
+							VpcId:            aws.String("vpc-aaaaaa"),
 							Placement: &ec2.Placement{
 								AvailabilityZone: aws.String("ap-northeast-1a"),
 							},
@@ -65,6 +100,10 @@ func TestDescribeRunningEC2s(t *testing.T) {
 									Key:   aws.String("Name"),
 									Value: aws.String("hoge"),
 								},
+								{
+									Key:   aws.String("omssh:bastion"),
+									Value: aws.String("true"),
+								},
 							},
 						},
 					},
@@ -76,6 +115,7 @@ func TestDescribeRunningEC2s(t *testing.T) {
 							InstanceType:     aws.String("t3.small"),
 							PublicIpAddress:  aws.String("12.34.56.02"),
 							PrivateIpAddress: aws.String("192.168.10.2"),
+							VpcId:            aws.String("vpc-aaaaaa"),
 							Placement: &ec2.Placement{
 								AvailabilityZone: aws.String("ap-northeast-1c"),
 							},
@@ -94,6 +134,7 @@ func TestDescribeRunningEC2s(t *testing.T) {
 							InstanceId:       aws.String("i-cccccc"),
 							InstanceType:     aws.String("t3.medium"),
 							PrivateIpAddress: aws.String("192.168.10.3"),
+							VpcId:            aws.String("vpc-aaaaaa"),
 							Placement: &ec2.Placement{
 								AvailabilityZone: aws.String("ap-northeast-1c"),
 							},
@@ -112,6 +153,7 @@ func TestDescribeRunningEC2s(t *testing.T) {
 							InstanceId:       aws.String("i-dddddd"),
 							InstanceType:     aws.String("t3.large"),
 							PrivateIpAddress: aws.String("192.168.10.4"),
+							VpcId:            aws.String("vpc-bbbbbb"),
 							Placement: &ec2.Placement{
 								AvailabilityZone: aws.String("ap-northeast-1c"),
 							},
@@ -130,6 +172,7 @@ func TestDescribeRunningEC2s(t *testing.T) {
 							InstanceId:       aws.String("i-eeeeee"),
 							InstanceType:     aws.String("t3.xlarge"),
 							PrivateIpAddress: aws.String("192.168.10.5"),
+							VpcId:            aws.String("vpc-bbbbbb"),
 							Placement: &ec2.Placement{
 								AvailabilityZone: aws.String("ap-northeast-1c"),
 							},
@@ -151,11 +194,168 @@ func TestDescribeRunningEC2s(t *testing.T) {
 		t.Error(err)
 	}
 
-	if diff := cmp.Diff(testEC2s, runningEC2s); diff != "" {
+	expected := []EC2{
+		{
+			InstanceID:       "i-aaaaaa",
+			PublicIPAddress:  "12.34.56.01",
+			PrivateIPAddress: "192.168.10.1",
+			InstanceType:     "t3.micro",
+			AvailabilityZone: "ap-northeast-1a",
+			InstanceName:     "hoge",
+			VpcID:            "vpc-aaaaaa",
+			Bastion:          true,
+			Tags:             map[string]string{"Name": "hoge", "omssh:bastion": "true"},
+			Lifecycle:        "on-demand",
+		},
+		{
+			InstanceID:       "i-bbbbbb",
+			PublicIPAddress:  "12.34.56.02",
+			PrivateIPAddress: "192.168.10.2",
+			InstanceType:     "t3.small",
+			AvailabilityZone: "ap-northeast-1c",
+			InstanceName:     "moge",
+			VpcID:            "vpc-aaaaaa",
+			Tags:             map[string]string{"Name": "moge"},
+			Lifecycle:        "on-demand",
+		},
+		{
+			InstanceID:       "i-cccccc",
+			PrivateIPAddress: "192.168.10.3",
+			InstanceType:     "t3.medium",
+			AvailabilityZone: "ap-northeast-1c",
+			InstanceName:     "foo",
+			VpcID:            "vpc-aaaaaa",
+			Tags:             map[string]string{"Name": "foo"},
+			Lifecycle:        "on-demand",
+		},
+		{
+			InstanceID:       "i-dddddd",
+			PrivateIPAddress: "192.168.10.4",
+			InstanceType:     "t3.large",
+			AvailabilityZone: "ap-northeast-1c",
+			InstanceName:     "baz",
+			VpcID:            "vpc-bbbbbb",
+			Tags:             map[string]string{"Name": "baz"},
+			Lifecycle:        "on-demand",
+		},
+		{
+			InstanceID:       "i-eeeeee",
+			PrivateIPAddress: "192.168.10.5",
+			InstanceType:     "t3.xlarge",
+			AvailabilityZone: "ap-northeast-1c",
+			InstanceName:     "bar",
+			VpcID:            "vpc-bbbbbb",
+			Tags:             map[string]string{"Name": "bar"},
+			Lifecycle:        "on-demand",
+		},
+	}
+	if diff := cmp.Diff(expected, runningEC2s); diff != "" {
 		t.Errorf("wrong result: \n%s", diff)
 	}
 }
 
+// richInstance : ec2 instance with every information omssh keeps
+func richInstance() *ec2.Instance {
+	return &ec2.Instance{
+		InstanceId:        aws.String("i-aaaaaa"),
+		InstanceType:      aws.String("m5.large"),
+		InstanceLifecycle: aws.String("spot"),
+		Architecture:      aws.String("x86_64"),
+		Platform:          aws.String("windows"),
+		ImageId:           aws.String("ami-aaaaaa"),
+		LaunchTime:        aws.Time(time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)),
+		KeyName:           aws.String("kenzo"),
+		IamInstanceProfile: &ec2.IamInstanceProfile{
+			Arn: aws.String("arn:aws:iam::123456789012:instance-profile/web"),
+		},
+		Placement:        &ec2.Placement{AvailabilityZone: aws.String("ap-northeast-1a")},
+		VpcId:            aws.String("vpc-aaaaaa"),
+		SubnetId:         aws.String("subnet-aaaaaa"),
+		PublicIpAddress:  aws.String("12.34.56.01"),
+		PrivateIpAddress: aws.String("192.168.10.1"),
+		PublicDnsName:    aws.String("ec2-12-34-56-01.ap-northeast-1.compute.amazonaws.com"),
+		PrivateDnsName:   aws.String("ip-192-168-10-1.ap-northeast-1.compute.internal"),
+		SecurityGroups: []*ec2.GroupIdentifier{
+			{GroupId: aws.String("sg-aaaaaa"), GroupName: aws.String("web")},
+			{GroupId: aws.String("sg-bbbbbb"), GroupName: aws.String("ssh")},
+		},
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{
+			{Ipv6Addresses: []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2001:db8::1")}}},
+		},
+		Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("web")},
+			{Key: aws.String("Env"), Value: aws.String("prod")},
+		},
+	}
+}
+
+func TestNewEC2(t *testing.T) {
+	expected := EC2{
+		InstanceID:         "i-aaaaaa",
+		PublicIPAddress:    "12.34.56.01",
+		PrivateIPAddress:   "192.168.10.1",
+		InstanceType:       "m5.large",
+		InstanceName:       "web",
+		AvailabilityZone:   "ap-northeast-1a",
+		VpcID:              "vpc-aaaaaa",
+		SubnetID:           "subnet-aaaaaa",
+		Tags:               map[string]string{"Name": "web", "Env": "prod"},
+		LaunchTime:         time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+		ImageID:            "ami-aaaaaa",
+		Platform:           "windows",
+		Architecture:       "x86_64",
+		Lifecycle:          "spot",
+		KeyName:            "kenzo",
+		IAMInstanceProfile: "arn:aws:iam::123456789012:instance-profile/web",
+		SecurityGroups:     []SecurityGroup{{ID: "sg-aaaaaa", Name: "web"}, {ID: "sg-bbbbbb", Name: "ssh"}},
+		IPv6Addresses:      []string{"2001:db8::1"},
+		PublicDNSName:      "ec2-12-34-56-01.ap-northeast-1.compute.amazonaws.com",
+		PrivateDNSName:     "ip-192-168-10-1.ap-northeast-1.compute.internal",
+	}
+	actual := newEC2(richInstance())
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	// serialised for other commands
+	b, err := json.Marshal(actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded EC2
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(actual, decoded); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if !strings.Contains(string(b), `"launch_time":"2019-10-01T00:00:00Z"`) {
+		t.Errorf("wrong result: \n%s", b)
+	}
+}
+
+func TestFindBastion(t *testing.T) {
+	ec2s := []EC2{
+		{InstanceID: "i-aaaaaa", PublicIPAddress: "12.34.56.01", VpcID: "vpc-aaaaaa"},
+		{InstanceID: "i-bbbbbb", PublicIPAddress: "12.34.56.02", VpcID: "vpc-aaaaaa", Bastion: true},
+		{InstanceID: "i-cccccc", VpcID: "vpc-bbbbbb", Bastion: true},
+		{InstanceID: "i-dddddd", VpcID: "vpc-aaaaaa"},
+	}
+
+	bastion, ok := FindBastion(ec2s, ec2s[3])
+	if !ok {
+		t.Fatal("wrong result: \nbastion is not found")
+	}
+	if diff := cmp.Diff(ec2s[1], bastion); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	// the bastion in vpc-bbbbbb has no public ip address
+	if _, ok := FindBastion(ec2s, EC2{InstanceID: "i-eeeeee", VpcID: "vpc-bbbbbb"}); ok {
+		t.Error("wrong result: \nbastion is found")
+	}
+}
+
 func TestDescribeNotFoundRunningEC2s(t *testing.T) {
 	m := NewEC2Client(&mockEC2Client{
 		Error: errors.New("error occured"),
@@ -172,19 +372,254 @@ func TestDescribeNotFoundRunningEC2s(t *testing.T) {
 	}
 }
 
-func finderEC2Testing(t *testing.T, types string, tests []EC2, expectedEC2 EC2) {
+func TestDescribeRegions(t *testing.T) {
+	m := NewEC2Client(&mockEC2Client{
+		RegionsResp: ec2.DescribeRegionsOutput{
+			Regions: []*ec2.Region{
+				{RegionName: aws.String("us-east-1")},
+				{RegionName: aws.String("ap-northeast-1")},
+			},
+		},
+	})
+	regions, err := m.DescribeRegions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"ap-northeast-1", "us-east-1"}, regions); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	m = NewEC2Client(&mockEC2Client{Error: errors.New("error occured")}, WithRegion("us-east-1"))
+	if _, err := m.DescribeRegions(); err == nil || err.Error() != "describe ec2 instances in us-east-1: error occured" {
+		t.Errorf("wrong result: \n%v", err)
+	}
+}
+
+// pagedEC2Client : ec2 api which returns instances in pages of NextToken,
+// and is throttled once at throttleAt page
+type pagedEC2Client struct {
+	ec2iface.EC2API
+	pages      []*ec2.DescribeInstancesOutput
+	throttleAt int
+	throttled  bool
+	requests   int
+}
+
+func newPagedEC2Client(pages, instancesPerPage, throttleAt int) *pagedEC2Client {
+	m := &pagedEC2Client{throttleAt: throttleAt}
+	for p := 0; p < pages; p++ {
+		instances := make([]*ec2.Instance, instancesPerPage)
+		for n := range instances {
+			instances[n] = &ec2.Instance{
+				InstanceId:       aws.String(fmt.Sprintf("i-%06d", p*instancesPerPage+n)),
+				InstanceType:     aws.String("t2.micro"),
+				PrivateIpAddress: aws.String("10.0.0.1"),
+				Placement:        &ec2.Placement{AvailabilityZone: aws.String("ap-northeast-1a")},
+			}
+		}
+		page := &ec2.DescribeInstancesOutput{
+			Reservations: []*ec2.Reservation{{Instances: instances}},
+		}
+		if p < pages-1 {
+			page.NextToken = aws.String(strconv.Itoa(p + 1))
+		}
+		m.pages = append(m.pages, page)
+	}
+	return m
+}
+
+func (m *pagedEC2Client) DescribeInstancesPages(input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
+	if aws.Int64Value(input.MaxResults) != describeMaxResults {
+		return fmt.Errorf("MaxResults is %d", aws.Int64Value(input.MaxResults))
+	}
+	p := 0
+	if input.NextToken != nil {
+		p, _ = strconv.Atoi(*input.NextToken)
+	}
+	for ; p < len(m.pages); p++ {
+		m.requests++
+		if p == m.throttleAt && !m.throttled {
+			m.throttled = true
+			return awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+		}
+		if !fn(m.pages[p], p == len(m.pages)-1) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestDescribeRunningEC2sPages(t *testing.T) {
+	for _, testcase := range []struct {
+		name             string
+		throttleAt       int
+		maxRetries       int
+		expectedLen      int
+		expectedRequests int
+		isErr            bool
+	}{
+		{
+			name:             "not throttled",
+			throttleAt:       -1,
+			maxRetries:       1,
+			expectedLen:      30,
+			expectedRequests: 3,
+		},
+		{
+			name:             "resumed from the throttled page",
+			throttleAt:       1,
+			maxRetries:       1,
+			expectedLen:      30,
+			expectedRequests: 4,
+		},
+		{
+			name:       "no retry",
+			throttleAt: 1,
+			maxRetries: 0,
+			isErr:      true,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			m := newPagedEC2Client(3, 10, testcase.throttleAt)
+			var progress strings.Builder
+			var slept []time.Duration
+			c := NewEC2Client(m, WithProgress(&progress), WithRetry(testcase.maxRetries, time.Second))
+			c.(*EC2Instance).sleep = func(d time.Duration) { slept = append(slept, d) }
+
+			e, err := c.DescribeRunningEC2s()
+			if testcase.isErr {
+				if _, ok := err.(*DescribeError); !ok {
+					t.Errorf("wrong result: \n%#v is not *DescribeError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expectedLen, len(e)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if diff := cmp.Diff("i-000029", e[len(e)-1].InstanceID); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.expectedRequests, m.requests); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.expectedRequests-3, len(slept)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if !strings.HasSuffix(progress.String(), "30 instances in 3 pages\n") {
+				t.Errorf("wrong result: \n%q", progress.String())
+			}
+		})
+	}
+}
+
+func BenchmarkDescribeRunningEC2s(b *testing.B) {
+	m := newPagedEC2Client(100, describeMaxResults, -1)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		c := NewEC2Client(m, WithProgress(ioutil.Discard))
+		e, err := c.DescribeRunningEC2s()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(e) != 100*describeMaxResults {
+			b.Fatalf("wrong result: \n%d instances", len(e))
+		}
+	}
+}
+
+const testConsoleOutput = `[    0.000000] Linux version 4.15.0-1044-aws
+ec2: -----BEGIN SSH HOST KEY FINGERPRINTS-----
+ec2: 1024 SHA256:oldoldoldoldoldoldoldoldoldoldoldoldoldoldo root@ip-192-168-10-1 (DSA)
+ec2: -----END SSH HOST KEY FINGERPRINTS-----
+[    0.000000] Linux version 4.15.0-1044-aws
+-----BEGIN SSH HOST KEY FINGERPRINTS-----
+256 SHA256:VzBZgCn2DLFvK/YfkOLDtk0AO6jAfZKjVPEjRNyQdn8 root@ip-192-168-10-1 (ECDSA)
+256 SHA256:m0Ve2bB7gCNbGg8WUgBy9F0XYvjS8e7TyAAy0Rq9YV8 root@ip-192-168-10-1 (ED25519)
+2048 MD5:3f:84:a2:17:5b:0c:6e:91:d4:28:7a:e0:55:1b:c9:02 root@ip-192-168-10-1 (RSA)
+-----END SSH HOST KEY FINGERPRINTS-----
+Cloud-init v. 19.2 finished
+`
+
+func TestGetConsoleOutput(t *testing.T) {
+	m := NewEC2Client(&mockEC2Client{
+		ConsoleOutputResp: ec2.GetConsoleOutputOutput{
+			InstanceId: aws.String("i-aaaaaa"),
+			Output:     aws.String(base64.StdEncoding.EncodeToString([]byte(testConsoleOutput))),
+		},
+	})
+
+	output, err := m.GetConsoleOutput("i-aaaaaa")
+	if err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(testConsoleOutput, output); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestGetConsoleOutputWithError(t *testing.T) {
+	m := NewEC2Client(&mockEC2Client{
+		Error: errors.New("error occured"),
+	})
+
+	output, err := m.GetConsoleOutput("i-aaaaaa")
+	if err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+	if diff := cmp.Diff("", output); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestWaitUntilInstanceStatusOK(t *testing.T) {
+	m := NewEC2Client(&mockEC2Client{})
+	if err := m.WaitUntilInstanceStatusOK([]string{"i-aaaaaa"}); err != nil {
+		t.Error(err)
+	}
+
+	m = NewEC2Client(&mockEC2Client{
+		Error: errors.New("error occured"),
+	})
+	if err := m.WaitUntilInstanceStatusOK([]string{"i-aaaaaa"}); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
+
+func TestParseHostKeyFingerprints(t *testing.T) {
+	expected := []string{
+		"SHA256:VzBZgCn2DLFvK/YfkOLDtk0AO6jAfZKjVPEjRNyQdn8",
+		"SHA256:m0Ve2bB7gCNbGg8WUgBy9F0XYvjS8e7TyAAy0Rq9YV8",
+		"3f:84:a2:17:5b:0c:6e:91:d4:28:7a:e0:55:1b:c9:02",
+	}
+	if diff := cmp.Diff(expected, ParseHostKeyFingerprints(testConsoleOutput)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string(nil), ParseHostKeyFingerprints("Cloud-init v. 19.2 finished")); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func finderEC2Testing(t *testing.T, types string, tests []EC2, expectedEC2s []EC2, keys ...termbox.Key) {
 	term := fuzzyfinder.UseMockedTerminal()
 	term.SetSize(60, 10)
 
+	events := utility.TermboxKeys(types)
+	for _, k := range keys {
+		events = append(events, termbox.Event{Type: termbox.EventKey, Key: k})
+	}
 	term.SetEvents(append(
-		utility.TermboxKeys(types),
+		events,
 		termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})...)
 
-	actualEC2, err := FinderEC2(tests)
+	actualEC2s, err := FinderEC2(tests)
 	if err != nil {
 		t.Error("cannot get profile")
 	}
-	if diff := cmp.Diff(expectedEC2, actualEC2); diff != "" {
+	if diff := cmp.Diff(expectedEC2s, actualEC2s); diff != "" {
 		t.Errorf("wrong result: \n%s", diff)
 	}
 }
@@ -204,13 +639,15 @@ func TestFinderEC2(t *testing.T) {
 					t,
 					"i-a",
 					testEC2s,
-					EC2{
-						InstanceID:       "i-aaaaaa",
-						PublicIPAddress:  "12.34.56.01",
-						PrivateIPAddress: "192.168.10.1",
-						InstanceType:     "t3.micro",
-						AvailabilityZone: "ap-northeast-1a",
-						InstanceName:     "hoge",
+					[]EC2{
+						{
+							InstanceID:       "i-aaaaaa",
+							PublicIPAddress:  "12.34.56.01",
+							PrivateIPAddress: "192.168.10.1",
+							InstanceType:     "t3.micro",
+							AvailabilityZone: "ap-northeast-1a",
+							InstanceName:     "hoge",
+						},
 					},
 				)
 			},
@@ -221,17 +658,32 @@ func TestFinderEC2(t *testing.T) {
 				finderEC2Testing(t,
 					"i-b",
 					testEC2s,
-					EC2{
-						InstanceID:       "i-bbbbbb",
-						PublicIPAddress:  "12.34.56.02",
-						PrivateIPAddress: "192.168.10.2",
-						InstanceType:     "t3.small",
-						AvailabilityZone: "ap-northeast-1c",
-						InstanceName:     "moge",
+					[]EC2{
+						{
+							InstanceID:       "i-bbbbbb",
+							PublicIPAddress:  "12.34.56.02",
+							PrivateIPAddress: "192.168.10.2",
+							InstanceType:     "t3.small",
+							AvailabilityZone: "ap-northeast-1c",
+							InstanceName:     "moge",
+						},
 					},
 				)
 			},
 		},
+		{
+			"select all by tab",
+			func(t *testing.T) {
+				finderEC2Testing(t,
+					"i-",
+					testEC2s,
+					testEC2s,
+					termbox.KeyTab,
+					termbox.KeyArrowUp,
+					termbox.KeyTab,
+				)
+			},
+		},
 		{
 			"type foo - Not found Instance name on terminal",
 			func(t *testing.T) {
@@ -247,7 +699,7 @@ func TestFinderEC2(t *testing.T) {
 				if err == nil {
 					t.Errorf("wrong result: \nerr is nil")
 				}
-				if diff := cmp.Diff(EC2{}, actual); diff != "" {
+				if diff := cmp.Diff([]EC2(nil), actual); diff != "" {
 					t.Errorf("wrong result: \n%s", diff)
 				}
 			},
@@ -0,0 +1,91 @@
+package awsapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// CredentialsError : aws credentials are missing, invalid or expired
+type CredentialsError struct {
+	Err error
+}
+
+func (e *CredentialsError) Error() string {
+	return fmt.Sprintf("aws credentials: %v", e.Err)
+}
+
+// MFAError : mfa token code to assume role is not available or wrong
+type MFAError struct {
+	Err error
+}
+
+func (e *MFAError) Error() string {
+	return fmt.Sprintf("mfa: %v", e.Err)
+}
+
+// DescribeError : ec2 instances cannot be described in Region of Account
+type DescribeError struct {
+	Region  string
+	Account string
+	Err     error
+}
+
+func (e *DescribeError) Error() string {
+	in := ""
+	if e.Region != "" {
+		in = " in " + e.Region
+	}
+	if e.Account != "" {
+		in += " of " + e.Account
+	}
+	return fmt.Sprintf("describe ec2 instances%s: %v", in, e.Err)
+}
+
+// KeyPushError : ssh public key cannot be sent to InstanceID with ec2 instance connect
+type KeyPushError struct {
+	InstanceID string
+	Err        error
+}
+
+func (e *KeyPushError) Error() string {
+	return fmt.Sprintf("send ssh public key to %s: %v", e.InstanceID, e.Err)
+}
+
+// credentialsErrorCodes : error codes of credential providers and of aws apis refusing credentials
+var credentialsErrorCodes = map[string]bool{
+	"NoCredentialProviders":       true,
+	"EnvAccessKeyNotFound":        true,
+	"EnvSecretNotFound":           true,
+	"SharedCredsLoad":             true,
+	"SharedCredsAccessKey":        true,
+	"SharedCredsSecret":           true,
+	"EmptyStaticCreds":            true,
+	"UserHomeNotFound":            true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InvalidClientTokenId":        true,
+	"UnrecognizedClientException": true,
+	"InvalidAccessKeyId":          true,
+	"SignatureDoesNotMatch":       true,
+	"AuthFailure":                 true,
+	// sts refuses to assume role
+	"AccessDenied": true,
+}
+
+// classifyError : err as *MFAError or *CredentialsError if it is caused by them, otherwise as other
+func classifyError(err error, other func(error) error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return other(err)
+	}
+	switch {
+	case aerr.Code() == "AssumeRoleTokenNotAvailable",
+		strings.Contains(aerr.Message(), "MultiFactorAuthentication"):
+		return &MFAError{Err: err}
+	case credentialsErrorCodes[aerr.Code()]:
+		return &CredentialsError{Err: err}
+	}
+	return other(err)
+}
@@ -0,0 +1,47 @@
+package awsapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClassifyError(t *testing.T) {
+	describeError := func(err error) error {
+		return &DescribeError{Err: err}
+	}
+	kind := func(err error) string {
+		switch err.(type) {
+		case *CredentialsError:
+			return "credentials"
+		case *MFAError:
+			return "mfa"
+		case *DescribeError:
+			return "describe"
+		}
+		return "unknown"
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"no credentials", credentials.ErrNoValidProvidersFoundInChain, "credentials"},
+		{"expired", awserr.NewRequestFailure(awserr.New("RequestExpired", "", nil), 400, ""), "describe"},
+		{"expired token", awserr.NewRequestFailure(awserr.New("ExpiredToken", "The security token included in the request is expired", nil), 400, ""), "credentials"},
+		{"wrong mfa", awserr.NewRequestFailure(awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil), 403, ""), "mfa"},
+		{"no mfa token", awserr.New("AssumeRoleTokenNotAvailable", "assume role with MFA enabled, but AssumeRoleTokenProvider session option not set.", nil), "mfa"},
+		{"unauthorized", awserr.NewRequestFailure(awserr.New("UnauthorizedOperation", "You are not authorized to perform this operation.", nil), 403, ""), "describe"},
+		{"not aws", errors.New("connection reset"), "describe"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			if diff := cmp.Diff(testcase.expected, kind(classifyError(testcase.err, describeError))); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
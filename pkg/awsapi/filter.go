@@ -0,0 +1,121 @@
+package awsapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/kenzo0107/omssh/pkg/filter"
+)
+
+// WithFilters : describe ec2 instances matching every filter of ec2 api, e.g. of ParseFilter and ParseTagFilter
+func WithFilters(filters []*ec2.Filter) EC2Option {
+	return func(i *EC2Instance) {
+		i.filters = append(i.filters, filters...)
+	}
+}
+
+// ParseFilter : parse filter of ec2 api, "name=value[,value...]", e.g. "vpc-id=vpc-aaaaaa" or "instance-type=m5.large,m5.xlarge".
+// Values match any of them, and may have wildcards * and ?.
+func ParseFilter(spec string) (*ec2.Filter, error) {
+	n := strings.Index(spec, "=")
+	if n <= 0 || n == len(spec)-1 {
+		return nil, fmt.Errorf("invalid filter %q: name=value[,value...]", spec)
+	}
+	return &ec2.Filter{
+		Name:   aws.String(spec[:n]),
+		Values: aws.StringSlice(strings.Split(spec[n+1:], ",")),
+	}, nil
+}
+
+// ParseTagFilter : parse filter of tag, "Key=Value[,Value...]", or "Key" for instances with the tag of any value
+func ParseTagFilter(spec string) (*ec2.Filter, error) {
+	n := strings.Index(spec, "=")
+	switch {
+	case spec == "" || n == 0:
+		return nil, fmt.Errorf("invalid tag %q: Key=Value or Key", spec)
+	case n < 0:
+		return &ec2.Filter{
+			Name:   aws.String("tag-key"),
+			Values: aws.StringSlice([]string{spec}),
+		}, nil
+	}
+	return ParseFilter("tag:" + spec)
+}
+
+// Attribute : value of field of ec2 instance in filter expressions, tag:Key for tags, and false if field is unknown
+func (e EC2) Attribute(field string) (string, bool) {
+	if strings.HasPrefix(field, "tag:") {
+		return e.Tags[strings.TrimPrefix(field, "tag:")], true
+	}
+	switch field {
+	case "id":
+		return e.InstanceID, true
+	case "name":
+		return e.InstanceName, true
+	case "type":
+		return e.InstanceType, true
+	case "az":
+		return e.AvailabilityZone, true
+	case "region":
+		return e.Region, true
+	case "account":
+		return e.AccountID, true
+	case "alias":
+		return e.AccountAlias, true
+	case "vpc":
+		return e.VpcID, true
+	case "public_ip":
+		return e.PublicIPAddress, true
+	case "private_ip":
+		return e.PrivateIPAddress, true
+	case "bastion":
+		return strconv.FormatBool(e.Bastion), true
+	case "subnet":
+		return e.SubnetID, true
+	case "ami":
+		return e.ImageID, true
+	case "platform":
+		return e.Platform, true
+	case "arch":
+		return e.Architecture, true
+	case "lifecycle":
+		return e.Lifecycle, true
+	case "key":
+		return e.KeyName, true
+	case "iam_profile":
+		return e.IAMInstanceProfile, true
+	case "public_dns":
+		return e.PublicDNSName, true
+	case "private_dns":
+		return e.PrivateDNSName, true
+	case "launch_time":
+		// RFC3339 in UTC, which sorts and matches by prefix, e.g. launch_time=~2019-10.*
+		return e.LaunchTime.UTC().Format(time.RFC3339), true
+	}
+	return "", false
+}
+
+// ParseEC2Expression : parse filter expression of ec2 instances, e.g. `tag:Env=prod && type=~m5.*`.
+// Fields are those of EC2.Attribute.
+func ParseEC2Expression(s string) (filter.Expression, error) {
+	return filter.Parse(s, func(field string) bool {
+		_, ok := EC2{}.Attribute(field)
+		return ok
+	})
+}
+
+// MatchEC2s : ec2 instances matching expression, in order
+func MatchEC2s(ec2s []EC2, expression filter.Expression) []EC2 {
+	var matched []EC2
+	for _, e := range ec2s {
+		if expression.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,144 @@
+package awsapi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, testcase := range []struct {
+		spec     string
+		expected *ec2.Filter
+		isErr    bool
+	}{
+		{
+			spec:     "vpc-id=vpc-aaaaaa",
+			expected: &ec2.Filter{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{"vpc-aaaaaa"})},
+		},
+		{
+			spec:     "instance-type=m5.large,m5.xlarge",
+			expected: &ec2.Filter{Name: aws.String("instance-type"), Values: aws.StringSlice([]string{"m5.large", "m5.xlarge"})},
+		},
+		{
+			spec:     "tag:aws:autoscaling:groupName=web",
+			expected: &ec2.Filter{Name: aws.String("tag:aws:autoscaling:groupName"), Values: aws.StringSlice([]string{"web"})},
+		},
+		{spec: "vpc-id", isErr: true},
+		{spec: "=vpc-aaaaaa", isErr: true},
+		{spec: "vpc-id=", isErr: true},
+	} {
+		t.Run(testcase.spec, func(t *testing.T) {
+			f, err := ParseFilter(testcase.spec)
+			if testcase.isErr {
+				if err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected.String(), f.String()); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseTagFilter(t *testing.T) {
+	for _, testcase := range []struct {
+		spec     string
+		expected *ec2.Filter
+		isErr    bool
+	}{
+		{
+			spec:     "Env=prod",
+			expected: &ec2.Filter{Name: aws.String("tag:Env"), Values: aws.StringSlice([]string{"prod"})},
+		},
+		{
+			spec:     "Env=prod,stg",
+			expected: &ec2.Filter{Name: aws.String("tag:Env"), Values: aws.StringSlice([]string{"prod", "stg"})},
+		},
+		{
+			spec:     "Env",
+			expected: &ec2.Filter{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{"Env"})},
+		},
+		{spec: "", isErr: true},
+		{spec: "=prod", isErr: true},
+	} {
+		t.Run(testcase.spec, func(t *testing.T) {
+			f, err := ParseTagFilter(testcase.spec)
+			if testcase.isErr {
+				if err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected.String(), f.String()); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithFilters(t *testing.T) {
+	vpc, err := ParseFilter("vpc-id=vpc-aaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockEC2Client{}
+	if _, err := NewEC2Client(m, WithFilters([]*ec2.Filter{vpc})).DescribeRunningEC2s(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*ec2.Filter{
+		{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"running"})},
+		vpc,
+	}
+	if diff := cmp.Diff(fmt.Sprint(expected), fmt.Sprint(m.Input.Filters)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestMatchEC2s(t *testing.T) {
+	ec2s := []EC2{
+		{InstanceID: "i-aaaaaa", InstanceType: "m5.large", Tags: map[string]string{"Env": "prod"}},
+		{InstanceID: "i-bbbbbb", InstanceType: "t3.micro", Tags: map[string]string{"Env": "prod"}},
+		{InstanceID: "i-cccccc", InstanceType: "m5.xlarge", Tags: map[string]string{"Env": "stg"}, Bastion: true},
+		{InstanceID: "i-dddddd", InstanceType: "m5.large"},
+	}
+	for _, testcase := range []struct {
+		expression string
+		expected   []string
+	}{
+		{`tag:Env=prod && type=~m5.*`, []string{"i-aaaaaa"}},
+		{`tag:Env=""`, []string{"i-dddddd"}},
+		{`bastion=true || id=i-bbbbbb`, []string{"i-bbbbbb", "i-cccccc"}},
+		{`type=c5.large`, nil},
+	} {
+		t.Run(testcase.expression, func(t *testing.T) {
+			e, err := ParseEC2Expression(testcase.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, i := range MatchEC2s(ec2s, e) {
+				actual = append(actual, i.InstanceID)
+			}
+			if diff := cmp.Diff(testcase.expected, actual); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+
+	if _, err := ParseEC2Expression("size=large"); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
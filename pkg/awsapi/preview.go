@@ -0,0 +1,97 @@
+package awsapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// previewEC2 : preview of ec2 instance in the finder of width and height, fitted in the pane on the right half.
+// Lines are wrapped, and lines beyond the pane are cut with how many are left, tags last.
+func previewEC2(e EC2, width, height int) string {
+	// borders and padding of the pane
+	paneWidth, paneHeight := width/2-4, height-2
+	if paneWidth <= 0 || paneHeight <= 0 {
+		return ""
+	}
+
+	var lines []string
+	for _, l := range previewLines(e) {
+		lines = append(lines, wrap(l, paneWidth)...)
+	}
+	if len(lines) > paneHeight {
+		more := len(lines) - paneHeight + 1
+		// cut in a narrow pane too
+		lines = append(lines[:paneHeight-1], wrap(fmt.Sprintf("... %d more lines, all in omssh list", more), paneWidth)[0])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// previewLines : information of ec2 instance, those telling apart instances of the same name first
+func previewLines(e EC2) []string {
+	platform := e.Platform
+	if platform == "" {
+		platform = "linux/unix"
+	}
+	launchTime := ""
+	if !e.LaunchTime.IsZero() {
+		launchTime = e.LaunchTime.Local().Format(time.RFC3339)
+	}
+	lines := []string{
+		"InstanceID: " + e.InstanceID,
+		"tag:Name: " + e.InstanceName,
+		fmt.Sprintf("InstanceType: %s (%s)", e.InstanceType, strings.TrimSpace(e.Lifecycle+" "+e.Architecture)),
+		"LaunchTime: " + launchTime,
+		fmt.Sprintf("ImageID: %s (%s)", e.ImageID, platform),
+		fmt.Sprintf("Zone: %s %s", e.Region, e.AvailabilityZone),
+	}
+	if e.AccountID != "" {
+		lines = append(lines, fmt.Sprintf("Account: %s %s", e.AccountID, e.AccountAlias))
+	}
+	lines = append(lines,
+		"VpcID: "+e.VpcID,
+		"SubnetID: "+e.SubnetID,
+		"PublicIP: "+e.PublicIPAddress,
+		"PrivateIP: "+e.PrivateIPAddress,
+	)
+	if len(e.IPv6Addresses) > 0 {
+		lines = append(lines, "IPv6: "+strings.Join(e.IPv6Addresses, ", "))
+	}
+	lines = append(lines,
+		"PublicDNS: "+e.PublicDNSName,
+		"PrivateDNS: "+e.PrivateDNSName,
+	)
+	groups := make([]string, 0, len(e.SecurityGroups))
+	for _, g := range e.SecurityGroups {
+		groups = append(groups, fmt.Sprintf("%s (%s)", g.ID, g.Name))
+	}
+	lines = append(lines,
+		"SecurityGroups: "+strings.Join(groups, ", "),
+		"KeyName: "+e.KeyName,
+		"IAMInstanceProfile: "+e.IAMInstanceProfile,
+		fmt.Sprintf("Bastion: %t", e.Bastion),
+	)
+
+	keys := make([]string, 0, len(e.Tags))
+	for k := range e.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines = append(lines, fmt.Sprintf("Tags: %d", len(keys)))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("  %s: %s", k, e.Tags[k]))
+	}
+	return lines
+}
+
+// wrap : split line into lines of width runes at most
+func wrap(line string, width int) []string {
+	r := []rune(line)
+	var lines []string
+	for len(r) > width {
+		lines = append(lines, string(r[:width]))
+		r = r[width:]
+	}
+	return append(lines, string(r))
+}
@@ -0,0 +1,60 @@
+package awsapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreviewEC2(t *testing.T) {
+	e := newEC2(richInstance())
+
+	t.Run("fits", func(t *testing.T) {
+		preview := previewEC2(e, 200, 40)
+		for _, expected := range []string{
+			"InstanceType: m5.large (spot x86_64)",
+			"ImageID: ami-aaaaaa (windows)",
+			"SubnetID: subnet-aaaaaa",
+			"IPv6: 2001:db8::1",
+			"SecurityGroups: sg-aaaaaa (web), sg-bbbbbb (ssh)",
+			"IAMInstanceProfile: arn:aws:iam::123456789012:instance-profile/web",
+			// sorted
+			"Tags: 2\n  Env: prod\n  Name: web",
+		} {
+			if !strings.Contains(preview, expected) {
+				t.Errorf("wrong result: \n%q does not contain %q", preview, expected)
+			}
+		}
+	})
+
+	t.Run("wrapped and cut", func(t *testing.T) {
+		lines := strings.Split(previewEC2(e, 60, 12), "\n")
+		if diff := cmp.Diff(10, len(lines)); diff != "" {
+			t.Errorf("wrong result: \n%s", diff)
+		}
+		for _, l := range lines {
+			if len([]rune(l)) > 26 {
+				t.Errorf("wrong result: \n%q is wider than the pane", l)
+			}
+		}
+		if last := lines[len(lines)-1]; !strings.HasPrefix(last, "... ") {
+			t.Errorf("wrong result: \n%q", last)
+		}
+	})
+
+	t.Run("too small", func(t *testing.T) {
+		if diff := cmp.Diff("", previewEC2(e, 8, 2)); diff != "" {
+			t.Errorf("wrong result: \n%s", diff)
+		}
+	})
+}
+
+func TestWrap(t *testing.T) {
+	if diff := cmp.Diff([]string{"abc", "def", "g"}, wrap("abcdefg", 3)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff([]string{""}, wrap("", 3)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
@@ -0,0 +1,119 @@
+package awsapi
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+)
+
+// AllRegions : region spec of every region enabled in the account
+const AllRegions = "all"
+
+// ParseRegions : parse regions separated by commas, e.g. "ap-northeast-1,us-east-1", in order without duplicates
+func ParseRegions(spec string) []string {
+	var regions []string
+	seen := map[string]bool{}
+	for _, r := range strings.Split(spec, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		regions = append(regions, r)
+	}
+	return regions
+}
+
+// describeConcurrency : clients describing ec2 instances at once, e.g. of regions in accounts
+const describeConcurrency = 16
+
+// DescribeRunningEC2sConcurrently : get list of running ec2 instances with clients concurrently, e.g. of regions,
+// in order of clients. The error is that of the first client which fails.
+func DescribeRunningEC2sConcurrently(clients []EC2Iface) ([]EC2, error) {
+	results, errs := describeConcurrently(clients)
+
+	var e []EC2
+	for n := range clients {
+		if errs[n] != nil {
+			return nil, errs[n]
+		}
+		e = append(e, results[n]...)
+	}
+	return e, nil
+}
+
+// DescribeRunningEC2sSkippingErrors : get list of running ec2 instances with clients concurrently like DescribeRunningEC2sConcurrently,
+// skipping clients which fail, e.g. of accounts where the role cannot be assumed. The errors are those of the skipped clients.
+func DescribeRunningEC2sSkippingErrors(clients []EC2Iface) ([]EC2, []error) {
+	results, errs := describeConcurrently(clients)
+
+	var e []EC2
+	var skipped []error
+	for n := range clients {
+		if errs[n] != nil {
+			skipped = append(skipped, errs[n])
+			continue
+		}
+		e = append(e, results[n]...)
+	}
+	return e, skipped
+}
+
+// describeConcurrently : ec2 instances and errors of each client
+func describeConcurrently(clients []EC2Iface) ([][]EC2, []error) {
+	results := make([][]EC2, len(clients))
+	errs := make([]error, len(clients))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, describeConcurrency)
+	for n, client := range clients {
+		wg.Add(1)
+		go func(n int, client EC2Iface) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[n], errs[n] = client.DescribeRunningEC2s()
+		}(n, client)
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// RegionalEC2InstanceConnect : ec2 instance connect clients of regions.
+// PushSSHPublicKey sends ssh public keys with the client of the region of ec2 instance.
+type RegionalEC2InstanceConnect map[string]EC2InstanceConnectIface
+
+// SendSSHPubKey : send ssh public key with the client of the region of the availability zone
+func (r RegionalEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	zone := ""
+	if p.AvailabilityZone != nil {
+		zone = *p.AvailabilityZone
+	}
+	client, ok := r[RegionOfZone(zone, r.regions())]
+	if !ok {
+		return false, errors.New("no ec2 instance connect client in the region of " + zone)
+	}
+	return client.SendSSHPubKey(p)
+}
+
+func (r RegionalEC2InstanceConnect) regions() []string {
+	regions := make([]string, 0, len(r))
+	for region := range r {
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// RegionOfZone : region of availability zone, the longest of regions which prefixes it,
+// e.g. us-west-2 of us-west-2a and of us-west-2-lax-1a. Empty if none.
+func RegionOfZone(zone string, regions []string) string {
+	region := ""
+	for _, r := range regions {
+		if strings.HasPrefix(zone, r) && len(r) > len(region) {
+			region = r
+		}
+	}
+	return region
+}
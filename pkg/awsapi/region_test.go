@@ -0,0 +1,164 @@
+package awsapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRegions(t *testing.T) {
+	for _, testcase := range []struct {
+		spec     string
+		expected []string
+	}{
+		{"ap-northeast-1", []string{"ap-northeast-1"}},
+		{"ap-northeast-1, us-east-1,eu-west-1", []string{"ap-northeast-1", "us-east-1", "eu-west-1"}},
+		{"us-east-1,us-east-1,", []string{"us-east-1"}},
+		{"all", []string{"all"}},
+		{"", nil},
+	} {
+		t.Run(testcase.spec, func(t *testing.T) {
+			if diff := cmp.Diff(testcase.expected, ParseRegions(testcase.spec)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func regionEC2Client(region, instanceID string, err error) EC2Iface {
+	return NewEC2Client(&mockEC2Client{
+		Resp: ec2.DescribeInstancesOutput{
+			Reservations: []*ec2.Reservation{{
+				Instances: []*ec2.Instance{{
+					InstanceId:   aws.String(instanceID),
+					InstanceType: aws.String("t2.micro"),
+					Placement:    &ec2.Placement{AvailabilityZone: aws.String(region + "a")},
+				}},
+			}},
+		},
+		Error: err,
+	}, WithRegion(region))
+}
+
+func TestDescribeRunningEC2sConcurrently(t *testing.T) {
+	tokyo := regionEC2Client("ap-northeast-1", "i-aaaaaa", nil)
+	virginia := regionEC2Client("us-east-1", "i-bbbbbb", nil)
+	ireland := regionEC2Client("eu-west-1", "i-cccccc", errors.New("error occured"))
+
+	e, err := DescribeRunningEC2sConcurrently([]EC2Iface{virginia, tokyo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual [][]string
+	for _, i := range e {
+		actual = append(actual, []string{i.InstanceID, i.Region})
+	}
+	expected := [][]string{{"i-bbbbbb", "us-east-1"}, {"i-aaaaaa", "ap-northeast-1"}}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	_, err = DescribeRunningEC2sConcurrently([]EC2Iface{virginia, ireland})
+	if d, ok := err.(*DescribeError); !ok || d.Region != "eu-west-1" {
+		t.Errorf("wrong result: \n%#v", err)
+	}
+}
+
+func TestDescribeRunningEC2sSkippingErrors(t *testing.T) {
+	tokyo := regionEC2Client("ap-northeast-1", "i-aaaaaa", nil)
+	ireland := regionEC2Client("eu-west-1", "i-cccccc", errors.New("error occured"))
+
+	e, errs := DescribeRunningEC2sSkippingErrors([]EC2Iface{ireland, tokyo})
+	var actual []string
+	for _, i := range e {
+		actual = append(actual, i.InstanceID)
+	}
+	if diff := cmp.Diff([]string{"i-aaaaaa"}, actual); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("wrong result: \n%v", errs)
+	}
+	if d, ok := errs[0].(*DescribeError); !ok || d.Region != "eu-west-1" {
+		t.Errorf("wrong result: \n%#v", errs[0])
+	}
+}
+
+func BenchmarkDescribeRunningEC2sConcurrently(b *testing.B) {
+	// 30 accounts in 3 regions
+	var clients []EC2Iface
+	for n := 0; n < 90; n++ {
+		clients = append(clients, NewEC2Client(newPagedEC2Client(2, 100, -1)))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		e, err := DescribeRunningEC2sConcurrently(clients)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(e) != 90*200 {
+			b.Fatalf("wrong result: \n%d instances", len(e))
+		}
+	}
+}
+
+func TestRegionOfZone(t *testing.T) {
+	regions := []string{"us-west-2", "us-west-1", "ap-northeast-1"}
+	for _, testcase := range []struct {
+		zone     string
+		expected string
+	}{
+		{"us-west-2a", "us-west-2"},
+		{"us-west-1c", "us-west-1"},
+		{"us-west-2-lax-1a", "us-west-2"},
+		{"eu-west-1a", ""},
+	} {
+		t.Run(testcase.zone, func(t *testing.T) {
+			if diff := cmp.Diff(testcase.expected, RegionOfZone(testcase.zone, regions)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+// regionEC2InstanceConnect : ec2 instance connect client which records ec2 instances in its region
+type regionEC2InstanceConnect struct {
+	sent []string
+}
+
+func (r *regionEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	r.sent = append(r.sent, *p.InstanceId)
+	return true, nil
+}
+
+func TestRegionalEC2InstanceConnect(t *testing.T) {
+	tokyo := &regionEC2InstanceConnect{}
+	virginia := &regionEC2InstanceConnect{}
+	client := RegionalEC2InstanceConnect{"ap-northeast-1": tokyo, "us-east-1": virginia}
+
+	for _, e := range []EC2{
+		{InstanceID: "i-aaaaaa", AvailabilityZone: "ap-northeast-1a", Region: "ap-northeast-1"},
+		{InstanceID: "i-bbbbbb", AvailabilityZone: "us-east-1b", Region: "us-east-1"},
+		// without region, by availability zone
+		{InstanceID: "i-cccccc", AvailabilityZone: "us-east-1c"},
+	} {
+		if err := PushSSHPublicKey(client, e, "ubuntu", "ssh-ed25519 AAAA"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff([]string{"i-aaaaaa"}, tokyo.sent); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"i-bbbbbb", "i-cccccc"}, virginia.sent); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	err := PushSSHPublicKey(client, EC2{InstanceID: "i-dddddd", AvailabilityZone: "eu-west-1a", Region: "eu-west-1"}, "ubuntu", "ssh-ed25519 AAAA")
+	if _, ok := err.(*KeyPushError); !ok {
+		t.Errorf("wrong result: \n%#v is not *KeyPushError", err)
+	}
+}
@@ -8,8 +8,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
-// NewSession : return new session
-func NewSession(profile, region string) *session.Session {
+// NewSession : return new session, cfgs such as http client through proxy are merged
+func NewSession(profile, region string, cfgs ...*aws.Config) *session.Session {
 	var config aws.Config
 	if profile != "" {
 		creds := credentials.NewSharedCredentials("", profile)
@@ -22,7 +22,7 @@ func NewSession(profile, region string) *session.Session {
 			Region: aws.String(region),
 		}
 	}
-	return session.Must(session.NewSession(&config))
+	return session.Must(session.NewSession(append([]*aws.Config{&config}, cfgs...)...))
 }
 
 // GetProfileWithAssumeRole : get profile with assume role and etc...
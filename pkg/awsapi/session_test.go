@@ -1,10 +1,12 @@
 package awsapi
 
 import (
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -61,6 +63,16 @@ func TestNewSession(t *testing.T) {
 				}
 			},
 		},
+		{
+			"Set http client",
+			func(t *testing.T) {
+				httpClient := &http.Client{}
+				s := NewSession("hoge", "ap-northeast-1", &aws.Config{HTTPClient: httpClient})
+				if s.Config.HTTPClient != httpClient {
+					t.Error("wrong result: \nhttp client is not set")
+				}
+			},
+		},
 		{
 			"set not found profile",
 			func(t *testing.T) {
@@ -0,0 +1,44 @@
+package awsapi
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// CallerIdentity : aws identity of the credentials
+type CallerIdentity struct {
+	Account string
+	Arn     string
+	UserID  string
+}
+
+// STSIface : sts interface
+type STSIface interface {
+	GetCallerIdentity() (CallerIdentity, error)
+}
+
+// STSInstance : sts instance
+type STSInstance struct {
+	client stsiface.STSAPI
+}
+
+// NewSTSClient : new sts client
+func NewSTSClient(svc stsiface.STSAPI) STSIface {
+	return &STSInstance{
+		client: svc,
+	}
+}
+
+// GetCallerIdentity : get aws identity of the credentials of the session
+func (i *STSInstance) GetCallerIdentity() (CallerIdentity, error) {
+	r, err := i.client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return CallerIdentity{}, err
+	}
+	return CallerIdentity{
+		Account: aws.StringValue(r.Account),
+		Arn:     aws.StringValue(r.Arn),
+		UserID:  aws.StringValue(r.UserId),
+	}, nil
+}
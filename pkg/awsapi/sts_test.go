@@ -0,0 +1,53 @@
+package awsapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockSTSiface struct {
+	stsiface.STSAPI
+
+	Resp  sts.GetCallerIdentityOutput
+	Error error
+}
+
+func (m *mockSTSiface) GetCallerIdentity(p *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &m.Resp, m.Error
+}
+
+func TestGetCallerIdentity(t *testing.T) {
+	m := NewSTSClient(&mockSTSiface{
+		Resp: sts.GetCallerIdentityOutput{
+			Account: aws.String("123456789012"),
+			Arn:     aws.String("arn:aws:sts::123456789012:assumed-role/admin/kenzo"),
+			UserId:  aws.String("AROAXXXXXXXXXXXXXXXXX:kenzo"),
+		},
+	})
+	identity, err := m.GetCallerIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CallerIdentity{
+		Account: "123456789012",
+		Arn:     "arn:aws:sts::123456789012:assumed-role/admin/kenzo",
+		UserID:  "AROAXXXXXXXXXXXXXXXXX:kenzo",
+	}
+	if diff := cmp.Diff(expected, identity); diff != "" {
+		t.Errorf("wrong result \n%s", diff)
+	}
+}
+
+func TestGetCallerIdentityWithError(t *testing.T) {
+	m := NewSTSClient(&mockSTSiface{
+		Error: errors.New("error occured"),
+	})
+	if _, err := m.GetCallerIdentity(); err == nil {
+		t.Error("wrong result \n err is nil")
+	}
+}
@@ -0,0 +1,117 @@
+package eice
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// stateCreateComplete : state of ec2 instance connect endpoint available for tunnels
+const stateCreateComplete = "create-complete"
+
+// EndpointIface : ec2 instance connect endpoint interface
+type EndpointIface interface {
+	DescribeInstanceConnectEndpoints(vpcID string) ([]Endpoint, error)
+}
+
+// EndpointClient : ec2 api client for ec2 instance connect endpoints
+type EndpointClient struct {
+	client *client.Client
+}
+
+// Endpoint : required ec2 instance connect endpoint information
+type Endpoint struct {
+	ID       string
+	DNSName  string
+	VpcID    string
+	SubnetID string
+	State    string
+}
+
+// Available : whether tunnels can be opened through the endpoint
+func (e Endpoint) Available() bool {
+	return e.State == stateCreateComplete
+}
+
+// NewEndpointClient : new ec2 instance connect endpoint client from ec2 client, e.g. ec2.New(sess).Client.
+// The api is called as a raw ec2 query, which the aws sdk does not support yet.
+func NewEndpointClient(c *client.Client) EndpointIface {
+	return &EndpointClient{
+		client: c,
+	}
+}
+
+type describeInstanceConnectEndpointsInput struct {
+	_ struct{} `type:"structure"`
+
+	Filters []*ec2.Filter `locationName:"Filter" locationNameList:"Filter" type:"list"`
+
+	NextToken *string `type:"string"`
+}
+
+type describeInstanceConnectEndpointsOutput struct {
+	_ struct{} `type:"structure"`
+
+	InstanceConnectEndpoints []*instanceConnectEndpoint `locationName:"instanceConnectEndpointSet" locationNameList:"item" type:"list"`
+
+	NextToken *string `locationName:"nextToken" type:"string"`
+}
+
+type instanceConnectEndpoint struct {
+	_ struct{} `type:"structure"`
+
+	InstanceConnectEndpointID *string `locationName:"instanceConnectEndpointId" type:"string"`
+	DNSName                   *string `locationName:"dnsName" type:"string"`
+	VpcID                     *string `locationName:"vpcId" type:"string"`
+	SubnetID                  *string `locationName:"subnetId" type:"string"`
+	State                     *string `locationName:"state" type:"string"`
+}
+
+// DescribeInstanceConnectEndpoints : get list of ec2 instance connect endpoints in the vpc
+func (c *EndpointClient) DescribeInstanceConnectEndpoints(vpcID string) ([]Endpoint, error) {
+	op := &request.Operation{
+		Name:       "DescribeInstanceConnectEndpoints",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	input := &describeInstanceConnectEndpointsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: []*string{aws.String(vpcID)},
+			},
+		},
+	}
+
+	var endpoints []Endpoint
+	for {
+		output := &describeInstanceConnectEndpointsOutput{}
+		if err := c.client.NewRequest(op, input, output).Send(); err != nil {
+			return nil, err
+		}
+		for _, e := range output.InstanceConnectEndpoints {
+			endpoints = append(endpoints, Endpoint{
+				ID:       aws.StringValue(e.InstanceConnectEndpointID),
+				DNSName:  aws.StringValue(e.DNSName),
+				VpcID:    aws.StringValue(e.VpcID),
+				SubnetID: aws.StringValue(e.SubnetID),
+				State:    aws.StringValue(e.State),
+			})
+		}
+		if aws.StringValue(output.NextToken) == "" {
+			return endpoints, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// FindEndpoint : find available ec2 instance connect endpoint
+func FindEndpoint(endpoints []Endpoint) (Endpoint, bool) {
+	for _, e := range endpoints {
+		if e.Available() {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
@@ -0,0 +1,108 @@
+package eice
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testDescribeResponse = `<DescribeInstanceConnectEndpointsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>hoge</requestId>
+    <instanceConnectEndpointSet>
+        <item>
+            <instanceConnectEndpointId>%s</instanceConnectEndpointId>
+            <dnsName>%s.ec2-instance-connect-endpoint.ap-northeast-1.amazonaws.com</dnsName>
+            <vpcId>vpc-aaaaaa</vpcId>
+            <subnetId>subnet-aaaaaa</subnetId>
+            <state>%s</state>
+        </item>
+    </instanceConnectEndpointSet>%s
+</DescribeInstanceConnectEndpointsResponse>`
+
+func TestDescribeInstanceConnectEndpoints(t *testing.T) {
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		q, err := url.ParseQuery(string(b))
+		if err != nil {
+			t.Error(err)
+		}
+		queries = append(queries, q)
+
+		// two pages
+		if q.Get("NextToken") == "" {
+			fmt.Fprintf(w, testDescribeResponse, "eice-aaaaaa", "eice-aaaaaa", "create-in-progress", "\n    <nextToken>moge</nextToken>")
+			return
+		}
+		fmt.Fprintf(w, testDescribeResponse, "eice-bbbbbb", "eice-bbbbbb", "create-complete", "")
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("ap-northeast-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	c := NewEndpointClient(ec2.New(sess).Client)
+
+	endpoints, err := c.DescribeInstanceConnectEndpoints("vpc-aaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Endpoint{
+		{
+			ID:       "eice-aaaaaa",
+			DNSName:  "eice-aaaaaa.ec2-instance-connect-endpoint.ap-northeast-1.amazonaws.com",
+			VpcID:    "vpc-aaaaaa",
+			SubnetID: "subnet-aaaaaa",
+			State:    "create-in-progress",
+		},
+		{
+			ID:       "eice-bbbbbb",
+			DNSName:  "eice-bbbbbb.ec2-instance-connect-endpoint.ap-northeast-1.amazonaws.com",
+			VpcID:    "vpc-aaaaaa",
+			SubnetID: "subnet-aaaaaa",
+			State:    "create-complete",
+		},
+	}
+	if diff := cmp.Diff(expected, endpoints); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if len(queries) != 2 {
+		t.Fatalf("wrong result: \n%v", queries)
+	}
+	for k, v := range map[string]string{
+		"Action":           "DescribeInstanceConnectEndpoints",
+		"Filter.1.Name":    "vpc-id",
+		"Filter.1.Value.1": "vpc-aaaaaa",
+	} {
+		if diff := cmp.Diff(v, queries[0].Get(k)); diff != "" {
+			t.Errorf("wrong result: %s\n%s", k, diff)
+		}
+	}
+	if diff := cmp.Diff("moge", queries[1].Get("NextToken")); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	endpoint, ok := FindEndpoint(endpoints)
+	if !ok {
+		t.Fatal("wrong result: \nendpoint is not found")
+	}
+	if diff := cmp.Diff("eice-bbbbbb", endpoint.ID); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
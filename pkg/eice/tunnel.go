@@ -0,0 +1,132 @@
+package eice
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	signingName        = "ec2-instance-connect"
+	presignExpiry      = time.Minute
+	defaultMaxDuration = time.Hour
+)
+
+// Dialer : opens tcp connections, such as omssh.Dialer
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Tunnel : opens tcp connections to private ip addresses through ec2 instance connect endpoint
+type Tunnel struct {
+	Endpoint    Endpoint
+	Region      string
+	Credentials *credentials.Credentials
+	// MaxDuration : how long a connection is kept open, 1 hour if zero
+	MaxDuration time.Duration
+	// Forward : dialer of the connection to the endpoint, e.g. through proxy, direct if nil
+	Forward Dialer
+
+	// baseURL : url of the endpoint instead of https://<dns name>, for tests
+	baseURL string
+}
+
+// Dial : open a connection to address, private ip address and port, over a signed websocket.
+// Dial can be used as dial function of ssh connections.
+func (t *Tunnel) Dial(network, address string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" {
+		return nil, fmt.Errorf("ec2 instance connect endpoint: unsupported network %s", network)
+	}
+
+	u, err := t.signedURL(address)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := websocket.NewConfig(u, "https://"+t.Endpoint.DNSName)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := t.dialWebsocket(config)
+	if err != nil {
+		return nil, fmt.Errorf("open tunnel to %s through %s: %v", address, t.Endpoint.ID, err)
+	}
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
+
+// dialWebsocket : open websocket to the endpoint directly or with Forward
+func (t *Tunnel) dialWebsocket(config *websocket.Config) (*websocket.Conn, error) {
+	if t.Forward == nil {
+		return websocket.DialConfig(config)
+	}
+
+	port := config.Location.Port()
+	if port == "" {
+		port = "80"
+		if config.Location.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	conn, err := t.Forward.Dial("tcp", net.JoinHostPort(config.Location.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if config.Location.Scheme == "wss" {
+		conn = tls.Client(conn, &tls.Config{ServerName: config.Location.Hostname()})
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// signedURL : websocket url of openTunnel presigned with sigv4
+func (t *Tunnel) signedURL(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+
+	maxDuration := t.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = defaultMaxDuration
+	}
+
+	base := t.baseURL
+	if base == "" {
+		base = "https://" + t.Endpoint.DNSName
+	}
+	q := url.Values{}
+	q.Set("instanceConnectEndpointId", t.Endpoint.ID)
+	q.Set("maxTunnelDuration", strconv.Itoa(int(maxDuration.Seconds())))
+	q.Set("privateIpAddress", host)
+	q.Set("remotePort", port)
+
+	req, err := http.NewRequest("GET", base+"/openTunnel?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := v4.NewSigner(t.Credentials).Presign(req, nil, signingName, t.Region, presignExpiry, time.Now()); err != nil {
+		return "", err
+	}
+
+	switch req.URL.Scheme {
+	case "https":
+		req.URL.Scheme = "wss"
+	case "http":
+		req.URL.Scheme = "ws"
+	}
+	return req.URL.String(), nil
+}
@@ -0,0 +1,181 @@
+package eice
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/websocket"
+)
+
+// endpointServer : stand-in of ec2 instance connect endpoint, which tunnels websocket to the requested address
+func endpointServer(t *testing.T, queries chan<- url.Values) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		q := ws.Request().URL.Query()
+		queries <- q
+		ws.PayloadType = websocket.BinaryFrame
+
+		conn, err := net.Dial("tcp", net.JoinHostPort(q.Get("privateIpAddress"), q.Get("remotePort")))
+		if err != nil {
+			log.Printf("Failed to dial (%s)", err)
+			return
+		}
+		go func() {
+			if _, err := io.Copy(conn, ws); err != nil {
+				log.Printf("Failed to copy (%s)", err)
+			}
+			_ = conn.Close()
+		}()
+		if _, err := io.Copy(ws, conn); err != nil {
+			log.Printf("Failed to copy (%s)", err)
+		}
+	}))
+}
+
+// echoServer : listen and echo back
+func echoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func TestTunnelDial(t *testing.T) {
+	echo := echoServer(t)
+	defer func() {
+		if err := echo.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	queries := make(chan url.Values, 1)
+	server := endpointServer(t, queries)
+	defer server.Close()
+
+	tunnel := &Tunnel{
+		Endpoint:    Endpoint{ID: "eice-aaaaaa", DNSName: "eice-aaaaaa.ec2-instance-connect-endpoint.ap-northeast-1.amazonaws.com"},
+		Region:      "ap-northeast-1",
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		baseURL:     server.URL,
+	}
+
+	conn, err := tunnel.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := fmt.Fprintln(conn, "hoge"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("hoge\n", line); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	host, port, err := net.SplitHostPort(echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := <-queries
+	for k, v := range map[string]string{
+		"instanceConnectEndpointId": "eice-aaaaaa",
+		"privateIpAddress":          host,
+		"remotePort":                port,
+		"maxTunnelDuration":         "3600",
+		"X-Amz-Algorithm":           "AWS4-HMAC-SHA256",
+	} {
+		if diff := cmp.Diff(v, q.Get(k)); diff != "" {
+			t.Errorf("wrong result: %s\n%s", k, diff)
+		}
+	}
+	if q.Get("X-Amz-Signature") == "" {
+		t.Error("wrong result: \nurl is not signed")
+	}
+}
+
+func TestTunnelDialWithForward(t *testing.T) {
+	echo := echoServer(t)
+	defer func() {
+		if err := echo.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	queries := make(chan url.Values, 1)
+	server := endpointServer(t, queries)
+	defer server.Close()
+
+	var forwarded string
+	tunnel := &Tunnel{
+		Endpoint:    Endpoint{ID: "eice-aaaaaa"},
+		Region:      "ap-northeast-1",
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		Forward: dialerFunc(func(network, address string) (net.Conn, error) {
+			forwarded = address
+			return net.Dial(network, address)
+		}),
+		baseURL: server.URL,
+	}
+
+	conn, err := tunnel.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-queries
+	if err := conn.Close(); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(server.Listener.Addr().String(), forwarded); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+type dialerFunc func(network, address string) (net.Conn, error)
+
+func (f dialerFunc) Dial(network, address string) (net.Conn, error) {
+	return f(network, address)
+}
+
+func TestTunnelDialError(t *testing.T) {
+	tunnel := &Tunnel{
+		Endpoint:    Endpoint{ID: "eice-aaaaaa"},
+		Region:      "ap-northeast-1",
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		baseURL:     "http://127.0.0.1:1",
+	}
+
+	if _, err := tunnel.Dial("udp", "10.0.0.1:22"); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+	if _, err := tunnel.Dial("tcp", "10.0.0.1:22"); err == nil {
+		t.Error("wrong result: \nerr is nil")
+	}
+}
@@ -0,0 +1,259 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Expression : client-side filter, e.g. `tag:Env=prod && type=~m5.*`
+//
+//	expression := or
+//	or         := and { "||" and }
+//	and        := unary { "&&" unary }
+//	unary      := "!" unary | "(" or ")" | field op value
+//	op         := "=" | "!=" | "=~" | "!~"
+//
+// =~ and !~ match the whole value with a regular expression.
+// Values with spaces are quoted by double quotes.
+type Expression interface {
+	Match(a Attributes) bool
+}
+
+// Attributes : values of fields which expressions are matched against, e.g. of an ec2 instance.
+// A field without value is empty.
+type Attributes interface {
+	Attribute(field string) (value string, ok bool)
+}
+
+type and struct {
+	l, r Expression
+}
+
+func (e *and) Match(a Attributes) bool {
+	return e.l.Match(a) && e.r.Match(a)
+}
+
+type or struct {
+	l, r Expression
+}
+
+func (e *or) Match(a Attributes) bool {
+	return e.l.Match(a) || e.r.Match(a)
+}
+
+type not struct {
+	e Expression
+}
+
+func (e *not) Match(a Attributes) bool {
+	return !e.e.Match(a)
+}
+
+// comparison : field op value
+type comparison struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (e *comparison) Match(a Attributes) bool {
+	v, _ := a.Attribute(e.field)
+	switch e.op {
+	case "=":
+		return v == e.value
+	case "!=":
+		return v != e.value
+	case "=~":
+		return e.re.MatchString(v)
+	default:
+		return !e.re.MatchString(v)
+	}
+}
+
+// operators : longest first
+var operators = []string{"=~", "!~", "!=", "="}
+
+// Parse : parse expression of s. Fields are checked by known, which accepts every field if nil.
+func Parse(s string, known func(field string) bool) (Expression, error) {
+	p := &parser{s: s, known: known}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+type parser struct {
+	s     string
+	pos   int
+	known func(field string) bool
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("invalid expression %q at %d: %s", p.s, p.pos, fmt.Sprintf(format, a...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// accept : consume tok if it is next
+func (p *parser) accept(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Expression, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &or{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (Expression, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &and{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) unary() (Expression, error) {
+	if p.accept("!") {
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{e}, nil
+	}
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("missing )")
+		}
+		return e, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expression, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && isFieldChar(p.s[p.pos]) {
+		p.pos++
+	}
+	field := p.s[start:p.pos]
+	if field == "" {
+		return nil, p.errorf("field expected")
+	}
+	if p.known != nil && !p.known(field) {
+		p.pos = start
+		return nil, p.errorf("unknown field %q", field)
+	}
+
+	op := ""
+	for _, o := range operators {
+		if p.accept(o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf("operator expected after %s: =, !=, =~ or !~", field)
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	c := &comparison{field: field, op: op, value: value}
+	if op == "=~" || op == "!~" {
+		if c.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	}
+	return c, nil
+}
+
+// value : quoted string, or characters until a space, && or || and an unbalanced )
+func (p *parser) value() (string, error) {
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		return p.quoted()
+	}
+
+	start := p.pos
+	depth := 0
+loop:
+	for ; p.pos < len(p.s); p.pos++ {
+		rest := p.s[p.pos:]
+		switch {
+		case unicode.IsSpace(rune(rest[0])):
+			break loop
+		case depth == 0 && (strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||")):
+			break loop
+		case rest[0] == '(':
+			depth++
+		case rest[0] == ')':
+			if depth == 0 {
+				break loop
+			}
+			depth--
+		}
+	}
+	return p.s[start:p.pos], nil
+}
+
+// quoted : string in double quotes, where \" and \\ are escaped
+func (p *parser) quoted() (string, error) {
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos++
+			b.WriteByte(p.s[p.pos])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("missing \"")
+}
+
+// isFieldChar : characters of fields, e.g. tag:aws:autoscaling:groupName
+func isFieldChar(c byte) bool {
+	return !unicode.IsSpace(rune(c)) && !strings.ContainsRune("=!~()&|\"", rune(c))
+}
@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// attributes : attributes of a map, where tag:X is empty if not found
+type attributes map[string]string
+
+func (a attributes) Attribute(field string) (string, bool) {
+	v, ok := a[field]
+	if !ok && strings.HasPrefix(field, "tag:") {
+		return "", true
+	}
+	return v, ok
+}
+
+func TestMatch(t *testing.T) {
+	a := attributes{
+		"tag:Env":  "prod",
+		"tag:Role": "web server",
+		"type":     "m5.large",
+		"name":     "web-1",
+	}
+	for _, testcase := range []struct {
+		expression string
+		expected   bool
+	}{
+		{`tag:Env=prod`, true},
+		{`tag:Env!=prod`, false},
+		{`tag:Env=prod && type=~m5.*`, true},
+		{`tag:Env=prod&&type=~c5.*`, false},
+		{`tag:Env=stg || type=~(m5|c5)\..*`, true},
+		{`type=~m5`, false},
+		{`type!~t3.*`, true},
+		{`!tag:Env=stg`, true},
+		{`!(tag:Env=prod && name=web-1)`, false},
+		{`(tag:Env=stg || name=web-1) && type=m5.large`, true},
+		{`tag:Role="web server"`, true},
+		{`tag:Owner=""`, true},
+		{`tag:Env=stg || tag:Env=prod && name=web-2`, false},
+	} {
+		t.Run(testcase.expression, func(t *testing.T) {
+			e, err := Parse(testcase.expression, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testcase.expected, e.Match(a)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	known := func(field string) bool {
+		return field == "type" || strings.HasPrefix(field, "tag:")
+	}
+	for _, testcase := range []struct {
+		expression string
+		expected   string
+	}{
+		{`type`, "operator expected"},
+		{`=m5`, "field expected"},
+		{`size=large`, `unknown field "size"`},
+		{`(type=m5`, "missing )"},
+		{`type=m5)`, `unexpected ")"`},
+		{`type=~[`, "missing closing ]"},
+		{`tag:Role="web`, `missing "`},
+		{`type=m5 &&`, "field expected"},
+	} {
+		t.Run(testcase.expression, func(t *testing.T) {
+			_, err := Parse(testcase.expression, known)
+			if err == nil {
+				t.Fatal("wrong result: \nerr is nil")
+			}
+			if !strings.Contains(err.Error(), testcase.expected) {
+				t.Errorf("wrong result: \n%q does not contain %q", err.Error(), testcase.expected)
+			}
+		})
+	}
+}
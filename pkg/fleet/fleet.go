@@ -0,0 +1,134 @@
+package fleet
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+const defaultConcurrency = 10
+
+// DialFunc : connect to ec2 instance with ssh, output of commands is written to stdout and stderr
+type DialFunc func(ec2 awsapi.EC2, stdout, stderr io.Writer) (omssh.Device, error)
+
+// exitStatus : error of command exited with non-zero status, e.g. *ssh.ExitError
+type exitStatus interface {
+	ExitStatus() int
+}
+
+// Runner : runs a command on ec2 instances in parallel
+type Runner struct {
+	Concurrency        int
+	User               string
+	PublicKey          string
+	EC2InstanceConnect awsapi.EC2InstanceConnectIface
+	Dial               DialFunc
+	Stdout             io.Writer
+	Stderr             io.Writer
+}
+
+// Result : result of a command on ec2 instance
+type Result struct {
+	EC2        awsapi.EC2
+	ExitStatus int
+	Err        error
+	Duration   time.Duration
+}
+
+// OK : whether the command exited with status 0
+func (r Result) OK() bool {
+	return r.Err == nil && r.ExitStatus == 0
+}
+
+// Run : send ssh public key to and run cmd on each ec2 instance, at most Concurrency at once.
+// Results are in the order of ec2s.
+func (r *Runner) Run(ec2s []awsapi.EC2, cmd string) []Result {
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	var stdoutMu, stderrMu sync.Mutex
+	results := make([]Result, len(ec2s))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, e := range ec2s {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, e awsapi.EC2) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("[%s %s] ", e.InstanceName, e.InstanceID)
+			stdout := NewPrefixWriter(r.Stdout, &stdoutMu, prefix)
+			stderr := NewPrefixWriter(r.Stderr, &stderrMu, prefix)
+
+			start := time.Now()
+			results[i] = r.run(e, cmd, stdout, stderr)
+			results[i].Duration = time.Since(start)
+
+			// partial last lines are best effort
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+		}(i, e)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (r *Runner) run(e awsapi.EC2, cmd string, stdout, stderr io.Writer) Result {
+	result := Result{EC2: e, ExitStatus: -1}
+
+	if err := awsapi.PushSSHPublicKey(r.EC2InstanceConnect, e, r.User, r.PublicKey); err != nil {
+		result.Err = err
+		return result
+	}
+
+	device, err := r.Dial(e, stdout, stderr)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer func() {
+		// the remote may have already closed the connection
+		_ = device.Close()
+	}()
+	device.SetupIO()
+
+	err = device.Run(cmd)
+	if e, ok := err.(exitStatus); ok {
+		result.ExitStatus = e.ExitStatus()
+		return result
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.ExitStatus = 0
+	return result
+}
+
+// PrintSummary : print exit status of every ec2 instance
+func PrintSummary(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	ok := 0
+	for _, r := range results {
+		status := fmt.Sprintf("exit %d", r.ExitStatus)
+		if r.Err != nil {
+			status = fmt.Sprintf("error: %v", r.Err)
+		}
+		if r.OK() {
+			ok++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.EC2.InstanceName, r.EC2.InstanceID, status, r.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(tw, "%d/%d succeeded\n", ok, len(results))
+	return tw.Flush()
+}
@@ -0,0 +1,165 @@
+package fleet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2instanceconnect"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+var (
+	testEC2s = []awsapi.EC2{
+		{InstanceID: "i-aaaaaa", InstanceName: "hoge"},
+		{InstanceID: "i-bbbbbb", InstanceName: "moge"},
+		{InstanceID: "i-cccccc", InstanceName: "foo"},
+		{InstanceID: "i-dddddd", InstanceName: "bar"},
+	}
+)
+
+type mockEC2InstanceConnect struct {
+	mu     sync.Mutex
+	pushed []string
+	fail   string
+}
+
+func (m *mockEC2InstanceConnect) SendSSHPubKey(p ec2instanceconnect.SendSSHPublicKeyInput) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pushed = append(m.pushed, aws.StringValue(p.InstanceId))
+	if aws.StringValue(p.InstanceId) == m.fail {
+		return false, errors.New("error occured")
+	}
+	return true, nil
+}
+
+// mockDevice : device running commands as "exit <status>" on the name of ec2 instance
+type mockDevice struct {
+	omssh.Device
+
+	ec2    awsapi.EC2
+	stdout io.Writer
+	stderr io.Writer
+	closed bool
+}
+
+func (m *mockDevice) SetupIO() {}
+
+func (m *mockDevice) Run(cmd string) error {
+	fmt.Fprintf(m.stdout, "%s on %s\npartial", cmd, m.ec2.InstanceName)
+	if m.ec2.InstanceName == "moge" {
+		fmt.Fprintln(m.stderr, "failed")
+		return mockExitError(2)
+	}
+	return nil
+}
+
+type mockExitError int
+
+func (e mockExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e)
+}
+
+func (e mockExitError) ExitStatus() int {
+	return int(e)
+}
+
+func (m *mockDevice) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestRunnerRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	eic := &mockEC2InstanceConnect{fail: "i-dddddd"}
+	var mu sync.Mutex
+	var devices []*mockDevice
+
+	r := &Runner{
+		Concurrency:        2,
+		User:               "ubuntu",
+		PublicKey:          "ssh-rsa AAAA",
+		EC2InstanceConnect: eic,
+		Dial: func(e awsapi.EC2, stdout, stderr io.Writer) (omssh.Device, error) {
+			if e.InstanceName == "foo" {
+				return nil, errors.New("connection refused")
+			}
+			d := &mockDevice{ec2: e, stdout: stdout, stderr: stderr}
+			mu.Lock()
+			devices = append(devices, d)
+			mu.Unlock()
+			return d, nil
+		},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+
+	results := r.Run(testEC2s, "uptime")
+
+	var actual []string
+	for _, result := range results {
+		actual = append(actual, fmt.Sprintf("%s %d %v %v", result.EC2.InstanceID, result.ExitStatus, result.Err, result.OK()))
+	}
+	expected := []string{
+		"i-aaaaaa 0 <nil> true",
+		"i-bbbbbb 2 <nil> false",
+		"i-cccccc -1 connection refused false",
+		"i-dddddd -1 send ssh public key to i-dddddd: error occured false",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	if diff := cmp.Diff(4, len(eic.pushed)); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	for _, d := range devices {
+		if !d.closed {
+			t.Errorf("wrong result: \n%s is not closed", d.ec2.InstanceID)
+		}
+	}
+
+	for _, line := range []string{
+		"[hoge i-aaaaaa] uptime on hoge\n",
+		"[hoge i-aaaaaa] partial\n",
+		"[moge i-bbbbbb] uptime on moge\n",
+		"[moge i-bbbbbb] partial\n",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("wrong result: \n%q is not in %q", line, stdout.String())
+		}
+	}
+	if diff := cmp.Diff("[moge i-bbbbbb] failed\n", stderr.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	var buf bytes.Buffer
+	err := PrintSummary(&buf, []Result{
+		{EC2: testEC2s[0], ExitStatus: 0},
+		{EC2: testEC2s[1], ExitStatus: 2},
+		{EC2: testEC2s[2], ExitStatus: -1, Err: errors.New("connection refused")},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := `hoge  i-aaaaaa  exit 0                     0s
+moge  i-bbbbbb  exit 2                     0s
+foo   i-cccccc  error: connection refused  0s
+1/3 succeeded
+`
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
@@ -0,0 +1,45 @@
+package fleet
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	hoge := NewPrefixWriter(&buf, &mu, "[hoge] ")
+	moge := NewPrefixWriter(&buf, &mu, "[moge] ")
+
+	for _, w := range []struct {
+		p *PrefixWriter
+		s string
+	}{
+		{hoge, "a\nb"},
+		{moge, "c\n"},
+		{hoge, "b\nd\n"},
+		{moge, "e"},
+	} {
+		n, err := w.p.Write([]byte(w.s))
+		if err != nil {
+			t.Error(err)
+		}
+		if diff := cmp.Diff(len(w.s), n); diff != "" {
+			t.Errorf("wrong result: \n%s", diff)
+		}
+	}
+	if err := hoge.Flush(); err != nil {
+		t.Error(err)
+	}
+	if err := moge.Flush(); err != nil {
+		t.Error(err)
+	}
+
+	expected := "[hoge] a\n[moge] c\n[hoge] bb\n[hoge] d\n[moge] e\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
@@ -0,0 +1,288 @@
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+// Batch : number of ec2 instances in a batch, or percentage of all ec2 instances
+type Batch struct {
+	Size    int
+	Percent bool
+}
+
+// ParseBatch : parse batch size such as "2" or "25%"
+func ParseBatch(s string) (Batch, error) {
+	s = strings.TrimSpace(s)
+	b := Batch{Percent: strings.HasSuffix(s, "%")}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || n <= 0 || (b.Percent && n > 100) {
+		return Batch{}, fmt.Errorf("invalid batch size %q: number of instances or percentage such as 25%%", s)
+	}
+	b.Size = n
+	return b, nil
+}
+
+// SizeOf : number of ec2 instances in a batch out of total, at least 1
+func (b Batch) SizeOf(total int) int {
+	n := b.Size
+	if b.Percent {
+		n = int(math.Ceil(float64(total) * float64(b.Size) / 100))
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (b Batch) String() string {
+	if b.Percent {
+		return fmt.Sprintf("%d%%", b.Size)
+	}
+	return strconv.Itoa(b.Size)
+}
+
+// Rollout : runs a command on ec2 instances batch by batch, and stops when too many of them fail
+type Rollout struct {
+	Runner      *Runner
+	Batch       Batch
+	Pause       time.Duration
+	MaxFailures int
+
+	// StatusCheck : wait until ec2 instances of a batch pass status checks, skipped if nil
+	StatusCheck func(instanceIDs []string) error
+
+	// HealthCheck : command which must succeed on every ec2 instance of a batch before the next batch
+	HealthCheck         string
+	HealthCheckTimeout  time.Duration
+	HealthCheckInterval time.Duration
+
+	Log   io.Writer
+	Sleep func(time.Duration)
+}
+
+// Report : machine readable result of rollout
+type Report struct {
+	Command     string        `json:"command"`
+	Batch       string        `json:"batch"`
+	MaxFailures int           `json:"max_failures"`
+	StartedAt   time.Time     `json:"started_at"`
+	FinishedAt  time.Time     `json:"finished_at"`
+	Succeeded   int           `json:"succeeded"`
+	Failed      int           `json:"failed"`
+	Skipped     int           `json:"skipped"`
+	Aborted     bool          `json:"aborted"`
+	AbortReason string        `json:"abort_reason,omitempty"`
+	Batches     []BatchReport `json:"batches"`
+}
+
+// BatchReport : result of a batch
+type BatchReport struct {
+	Number int          `json:"number"`
+	Hosts  []HostReport `json:"hosts"`
+}
+
+// HostReport : result of an ec2 instance
+type HostReport struct {
+	InstanceID   string  `json:"instance_id"`
+	InstanceName string  `json:"instance_name"`
+	Status       string  `json:"status"`
+	ExitStatus   int     `json:"exit_status"`
+	Error        string  `json:"error,omitempty"`
+	Duration     float64 `json:"duration_seconds"`
+}
+
+// host statuses of report
+const (
+	HostSucceeded = "succeeded"
+	HostFailed    = "failed"
+	HostUnhealthy = "unhealthy"
+	HostSkipped   = "skipped"
+)
+
+// OK : whether every ec2 instance succeeded
+func (r *Report) OK() bool {
+	return !r.Aborted && r.Failed == 0 && r.Skipped == 0
+}
+
+// WriteJSON : write report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// Run : run cmd on ec2s batch by batch
+func (r *Rollout) Run(ec2s []awsapi.EC2, cmd string) *Report {
+	report := &Report{
+		Command:     cmd,
+		Batch:       r.Batch.String(),
+		MaxFailures: r.MaxFailures,
+		StartedAt:   time.Now(),
+	}
+
+	size := r.Batch.SizeOf(len(ec2s))
+	for start, n := 0, 1; start < len(ec2s); start, n = start+size, n+1 {
+		end := start + size
+		if end > len(ec2s) {
+			end = len(ec2s)
+		}
+		batch := ec2s[start:end]
+
+		if report.Aborted {
+			br := BatchReport{Number: n}
+			for _, e := range batch {
+				br.Hosts = append(br.Hosts, HostReport{
+					InstanceID:   e.InstanceID,
+					InstanceName: e.InstanceName,
+					Status:       HostSkipped,
+					ExitStatus:   -1,
+				})
+				report.Skipped++
+			}
+			report.Batches = append(report.Batches, br)
+			continue
+		}
+
+		if n > 1 && r.Pause > 0 {
+			r.logf("pausing %s before batch %d\n", r.Pause, n)
+			r.sleep(r.Pause)
+		}
+
+		r.logf("batch %d: %s\n", n, instanceIDs(batch))
+		br := r.runBatch(n, batch, cmd)
+		for _, h := range br.Hosts {
+			if h.Status == HostSucceeded {
+				report.Succeeded++
+			} else {
+				report.Failed++
+			}
+		}
+		report.Batches = append(report.Batches, br)
+
+		if report.Failed > r.MaxFailures {
+			report.Aborted = true
+			report.AbortReason = fmt.Sprintf("%d failures exceeded max failures %d", report.Failed, r.MaxFailures)
+			r.logf("%s, skipping remaining instances\n", report.AbortReason)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report
+}
+
+func (r *Rollout) runBatch(n int, batch []awsapi.EC2, cmd string) BatchReport {
+	results := r.Runner.Run(batch, cmd)
+
+	hosts := make([]HostReport, len(results))
+	var succeeded []awsapi.EC2
+	for i, result := range results {
+		hosts[i] = hostReport(result)
+		if result.OK() {
+			succeeded = append(succeeded, result.EC2)
+		}
+	}
+
+	unhealthy := r.waitHealthy(succeeded)
+	for i := range hosts {
+		if reason, ok := unhealthy[hosts[i].InstanceID]; ok {
+			hosts[i].Status = HostUnhealthy
+			hosts[i].Error = reason
+		}
+	}
+
+	return BatchReport{Number: n, Hosts: hosts}
+}
+
+// waitHealthy : wait for status checks and health check, return reasons of unhealthy ec2 instances
+func (r *Rollout) waitHealthy(ec2s []awsapi.EC2) map[string]string {
+	unhealthy := map[string]string{}
+	if len(ec2s) == 0 {
+		return unhealthy
+	}
+
+	if r.StatusCheck != nil {
+		r.logf("waiting for status checks of %s\n", instanceIDs(ec2s))
+		if err := r.StatusCheck(instanceIDs(ec2s)); err != nil {
+			for _, e := range ec2s {
+				unhealthy[e.InstanceID] = fmt.Sprintf("status check: %v", err)
+			}
+			return unhealthy
+		}
+	}
+
+	if r.HealthCheck == "" {
+		return unhealthy
+	}
+
+	deadline := time.Now().Add(r.HealthCheckTimeout)
+	pending := ec2s
+	for {
+		r.logf("health check on %s: %s\n", instanceIDs(pending), r.HealthCheck)
+		var failed []awsapi.EC2
+		for _, result := range r.Runner.Run(pending, r.HealthCheck) {
+			delete(unhealthy, result.EC2.InstanceID)
+			if !result.OK() {
+				failed = append(failed, result.EC2)
+				unhealthy[result.EC2.InstanceID] = fmt.Sprintf("health check: %s", describeFailure(result))
+			}
+		}
+		if len(failed) == 0 || !time.Now().Before(deadline) {
+			return unhealthy
+		}
+		pending = failed
+		r.sleep(r.HealthCheckInterval)
+	}
+}
+
+func (r *Rollout) logf(format string, a ...interface{}) {
+	if r.Log != nil {
+		fmt.Fprintf(r.Log, format, a...)
+	}
+}
+
+func (r *Rollout) sleep(d time.Duration) {
+	if r.Sleep != nil {
+		r.Sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+func hostReport(result Result) HostReport {
+	h := HostReport{
+		InstanceID:   result.EC2.InstanceID,
+		InstanceName: result.EC2.InstanceName,
+		Status:       HostSucceeded,
+		ExitStatus:   result.ExitStatus,
+		Duration:     result.Duration.Seconds(),
+	}
+	if !result.OK() {
+		h.Status = HostFailed
+		h.Error = describeFailure(result)
+	}
+	return h
+}
+
+func describeFailure(result Result) string {
+	if result.Err != nil {
+		return result.Err.Error()
+	}
+	return fmt.Sprintf("exit status %d", result.ExitStatus)
+}
+
+func instanceIDs(ec2s []awsapi.EC2) []string {
+	ids := make([]string, len(ec2s))
+	for i, e := range ec2s {
+		ids[i] = e.InstanceID
+	}
+	return ids
+}
@@ -0,0 +1,230 @@
+package fleet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/kenzo0107/omssh"
+	"github.com/kenzo0107/omssh/pkg/awsapi"
+)
+
+// rolloutDevice : device failing commands listed for the ec2 instance
+type rolloutDevice struct {
+	omssh.Device
+
+	ec2  awsapi.EC2
+	fail map[string]string
+}
+
+func (d *rolloutDevice) SetupIO() {}
+
+func (d *rolloutDevice) Run(cmd string) error {
+	if d.fail[d.ec2.InstanceID] == cmd {
+		return mockExitError(1)
+	}
+	return nil
+}
+
+func (d *rolloutDevice) Close() error {
+	return nil
+}
+
+func newTestRollout(batch string, maxFailures int, fail map[string]string) *Rollout {
+	b, err := ParseBatch(batch)
+	if err != nil {
+		panic(err)
+	}
+	return &Rollout{
+		Runner: &Runner{
+			Concurrency:        2,
+			EC2InstanceConnect: &mockEC2InstanceConnect{},
+			Dial: func(e awsapi.EC2, stdout, stderr io.Writer) (omssh.Device, error) {
+				return &rolloutDevice{ec2: e, fail: fail}, nil
+			},
+			Stdout: ioutil.Discard,
+			Stderr: ioutil.Discard,
+		},
+		Batch:       b,
+		MaxFailures: maxFailures,
+		Sleep:       func(time.Duration) {},
+	}
+}
+
+func reportStatuses(r *Report) [][]string {
+	var statuses [][]string
+	for _, b := range r.Batches {
+		var s []string
+		for _, h := range b.Hosts {
+			s = append(s, h.InstanceID+" "+h.Status)
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+func TestParseBatch(t *testing.T) {
+	for s, expected := range map[string]Batch{
+		"2":    {Size: 2},
+		"25%":  {Size: 25, Percent: true},
+		"100%": {Size: 100, Percent: true},
+	} {
+		actual, err := ParseBatch(s)
+		if err != nil {
+			t.Error(err)
+		}
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("wrong result: %s\n%s", s, diff)
+		}
+		if diff := cmp.Diff(s, actual.String()); diff != "" {
+			t.Errorf("wrong result: \n%s", diff)
+		}
+	}
+
+	for _, s := range []string{"", "0", "-1", "101%", "hoge"} {
+		if _, err := ParseBatch(s); err == nil {
+			t.Errorf("wrong result: %q\nerr is nil", s)
+		}
+	}
+}
+
+func TestBatchSizeOf(t *testing.T) {
+	for _, testcase := range []struct {
+		batch    Batch
+		total    int
+		expected int
+	}{
+		{Batch{Size: 2}, 5, 2},
+		{Batch{Size: 25, Percent: true}, 4, 1},
+		{Batch{Size: 25, Percent: true}, 5, 2},
+		{Batch{Size: 10, Percent: true}, 3, 1},
+		{Batch{Size: 100, Percent: true}, 3, 3},
+	} {
+		if diff := cmp.Diff(testcase.expected, testcase.batch.SizeOf(testcase.total)); diff != "" {
+			t.Errorf("wrong result: %v of %d\n%s", testcase.batch, testcase.total, diff)
+		}
+	}
+}
+
+func TestRolloutRun(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		rollout  *Rollout
+		expected [][]string
+		ok       bool
+	}{
+		{
+			"all succeeded",
+			newTestRollout("50%", 0, nil),
+			[][]string{
+				{"i-aaaaaa succeeded", "i-bbbbbb succeeded"},
+				{"i-cccccc succeeded", "i-dddddd succeeded"},
+			},
+			true,
+		},
+		{
+			"stop when failures exceed max failures",
+			newTestRollout("1", 1, map[string]string{"i-aaaaaa": "deploy", "i-bbbbbb": "deploy"}),
+			[][]string{
+				{"i-aaaaaa failed"},
+				{"i-bbbbbb failed"},
+				{"i-cccccc skipped"},
+				{"i-dddddd skipped"},
+			},
+			false,
+		},
+		{
+			"health check failure",
+			func() *Rollout {
+				r := newTestRollout("3", 0, map[string]string{"i-bbbbbb": "healthy"})
+				r.HealthCheck = "healthy"
+				return r
+			}(),
+			[][]string{
+				{"i-aaaaaa succeeded", "i-bbbbbb unhealthy", "i-cccccc succeeded"},
+				{"i-dddddd skipped"},
+			},
+			false,
+		},
+		{
+			"status check failure",
+			func() *Rollout {
+				r := newTestRollout("2", 2, nil)
+				r.StatusCheck = func(ids []string) error {
+					if ids[0] == "i-cccccc" {
+						return errors.New("impaired")
+					}
+					return nil
+				}
+				return r
+			}(),
+			[][]string{
+				{"i-aaaaaa succeeded", "i-bbbbbb succeeded"},
+				{"i-cccccc unhealthy", "i-dddddd unhealthy"},
+			},
+			false,
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			r := testcase.rollout.Run(testEC2s, "deploy")
+			if diff := cmp.Diff(testcase.expected, reportStatuses(r)); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+			if diff := cmp.Diff(testcase.ok, r.OK()); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRolloutHealthCheckRetry(t *testing.T) {
+	fail := map[string]string{"i-aaaaaa": "healthy"}
+	r := newTestRollout("100%", 0, fail)
+	r.HealthCheck = "healthy"
+	r.HealthCheckTimeout = time.Minute
+	r.Sleep = func(time.Duration) {
+		// becomes healthy after a while
+		delete(fail, "i-aaaaaa")
+	}
+
+	report := r.Run(testEC2s, "deploy")
+	if !report.OK() {
+		t.Errorf("wrong result: \n%v", reportStatuses(report))
+	}
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	r := newTestRollout("2", 0, map[string]string{"i-aaaaaa": "deploy"})
+	report := r.Run(testEC2s, "deploy")
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual struct {
+		Command     string `json:"command"`
+		Failed      int    `json:"failed"`
+		Skipped     int    `json:"skipped"`
+		Aborted     bool   `json:"aborted"`
+		AbortReason string `json:"abort_reason"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("deploy", actual.Command); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff([]int{1, 2}, []int{actual.Failed, actual.Skipped}); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("1 failures exceeded max failures 0", actual.AbortReason); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
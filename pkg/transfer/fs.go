@@ -0,0 +1,78 @@
+package transfer
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// fileSystem : local or remote side of a copy
+type fileSystem interface {
+	Glob(pattern string) ([]string, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	MkdirAll(name string) error
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+// localFS : file system of the workstation
+type localFS struct{}
+
+func (localFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+func (localFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return f.Readdir(-1)
+}
+
+func (localFS) Open(name string) (io.ReadCloser, error) { return os.Open(filepath.Clean(name)) }
+
+func (localFS) Create(name string) (io.WriteCloser, error) {
+	return os.OpenFile(filepath.Clean(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func (localFS) MkdirAll(name string) error                { return os.MkdirAll(name, 0755) }
+func (localFS) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, mode) }
+
+func (localFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (localFS) Join(elem ...string) string { return filepath.Join(elem...) }
+func (localFS) Base(name string) string    { return filepath.Base(name) }
+
+// remoteFS : file system of ec2 instance through sftp
+type remoteFS struct {
+	client *sftp.Client
+}
+
+func (r remoteFS) Glob(pattern string) ([]string, error)      { return r.client.Glob(pattern) }
+func (r remoteFS) Stat(name string) (os.FileInfo, error)      { return r.client.Stat(name) }
+func (r remoteFS) ReadDir(name string) ([]os.FileInfo, error) { return r.client.ReadDir(name) }
+func (r remoteFS) Open(name string) (io.ReadCloser, error)    { return r.client.Open(name) }
+func (r remoteFS) Create(name string) (io.WriteCloser, error) { return r.client.Create(name) }
+func (r remoteFS) MkdirAll(name string) error                 { return r.client.MkdirAll(name) }
+func (r remoteFS) Chmod(name string, mode os.FileMode) error  { return r.client.Chmod(name, mode) }
+
+func (r remoteFS) Chtimes(name string, atime, mtime time.Time) error {
+	return r.client.Chtimes(name, atime, mtime)
+}
+
+func (r remoteFS) Join(elem ...string) string { return r.client.Join(elem...) }
+func (r remoteFS) Base(name string) string    { return path.Base(name) }
@@ -0,0 +1,58 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+)
+
+// progress : writer printing transferred bytes of a file
+type progress struct {
+	w       io.Writer
+	name    string
+	size    int64
+	written int64
+	percent int
+}
+
+func newProgress(w io.Writer, name string, size int64) *progress {
+	p := &progress{w: w, name: name, size: size, percent: -1}
+	p.print()
+	return p
+}
+
+// Write : count bytes and print when the percentage changes
+func (p *progress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	p.print()
+	return len(b), nil
+}
+
+// done : end the progress line
+func (p *progress) done() {
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) print() {
+	percent := 100
+	if p.size > 0 {
+		percent = int(p.written * 100 / p.size)
+	}
+	if percent == p.percent {
+		return
+	}
+	p.percent = percent
+	fmt.Fprintf(p.w, "\r%s  %3d%%  %s", p.name, percent, humanBytes(p.written))
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,183 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// Path : local path, or remote path "instance-id:/path" on ec2 instance
+type Path struct {
+	InstanceID string
+	Path       string
+}
+
+// ParsePath : parse local path or remote path "instance-id:/path"
+func ParsePath(s string) Path {
+	i := strings.Index(s, ":")
+	if i < 0 || !strings.HasPrefix(s, "i-") || strings.ContainsAny(s[:i], `/\`) {
+		return Path{Path: s}
+	}
+	p := s[i+1:]
+	if p == "" {
+		p = "."
+	}
+	return Path{InstanceID: s[:i], Path: p}
+}
+
+// Remote : whether the path is on ec2 instance
+func (p Path) Remote() bool {
+	return p.InstanceID != ""
+}
+
+func (p Path) String() string {
+	if p.Remote() {
+		return p.InstanceID + ":" + p.Path
+	}
+	return p.Path
+}
+
+// Copier : copies files between the workstation and ec2 instance like scp
+type Copier struct {
+	// Recursive : copy directories
+	Recursive bool
+	// Preserve : preserve permissions and modification times
+	Preserve bool
+	// Progress : progress of each file is written, no progress if nil
+	Progress io.Writer
+}
+
+// Upload : copy local files matching patterns to dst on the remote
+func (c *Copier) Upload(client *sftp.Client, patterns []string, dst string) error {
+	return c.copy(localFS{}, remoteFS{client}, patterns, dst)
+}
+
+// Download : copy remote files matching patterns to local dst
+func (c *Copier) Download(client *sftp.Client, patterns []string, dst string) error {
+	return c.copy(remoteFS{client}, localFS{}, patterns, dst)
+}
+
+func (c *Copier) copy(src, dst fileSystem, patterns []string, target string) error {
+	var sources []string
+	for _, pattern := range patterns {
+		matches, err := src.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("%s: no such file or directory", pattern)
+		}
+		sources = append(sources, matches...)
+	}
+
+	info, err := dst.Stat(target)
+	targetIsDir := err == nil && info.IsDir()
+	if len(sources) > 1 && !targetIsDir {
+		return fmt.Errorf("%s: not a directory", target)
+	}
+
+	for _, source := range sources {
+		to := target
+		if targetIsDir {
+			to = dst.Join(target, src.Base(source))
+		}
+		if err := c.copyEntry(src, dst, source, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Copier) copyEntry(src, dst fileSystem, from, to string) error {
+	info, err := src.Stat(from)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		if !c.Recursive {
+			return fmt.Errorf("%s: is a directory, copy with --recursive (-R)", from)
+		}
+		if err := c.copyDir(src, dst, from, to); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if err := c.copyFile(src, dst, from, to, info.Size()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: not a regular file", from)
+	}
+
+	if c.Preserve {
+		return preserve(dst, to, info)
+	}
+	return nil
+}
+
+func (c *Copier) copyDir(src, dst fileSystem, from, to string) error {
+	if err := dst.MkdirAll(to); err != nil {
+		return fmt.Errorf("%s: %v", to, err)
+	}
+	entries, err := src.ReadDir(from)
+	if err != nil {
+		return fmt.Errorf("%s: %v", from, err)
+	}
+	for _, e := range entries {
+		if err := c.copyEntry(src, dst, src.Join(from, e.Name()), dst.Join(to, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Copier) copyFile(src, dst fileSystem, from, to string, size int64) (err error) {
+	r, err := src.Open(from)
+	if err != nil {
+		return fmt.Errorf("%s: %v", from, err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	w, err := dst.Create(to)
+	if err != nil {
+		return fmt.Errorf("%s: %v", to, err)
+	}
+	defer func() {
+		if e := w.Close(); e != nil && err == nil {
+			err = fmt.Errorf("%s: %v", to, e)
+		}
+	}()
+
+	if c.Progress != nil {
+		p := newProgress(c.Progress, from, size)
+		defer p.done()
+		r = readCloser{io.TeeReader(r, p), r}
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("%s -> %s: %v", from, to, err)
+	}
+	return nil
+}
+
+// preserve : set permissions and modification time of info
+func preserve(fs fileSystem, name string, info os.FileInfo) error {
+	if err := fs.Chmod(name, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if err := fs.Chtimes(name, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,236 @@
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/sftp"
+)
+
+// newTestClient : sftp client connected to sftp server of local file system
+func newTestClient(t *testing.T) (*sftp.Client, func()) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverReader, serverWriter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		// ends with io.EOF when the client is closed
+		_ = server.Serve()
+		_ = server.Close()
+	}()
+
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, func() {
+		if err := client.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "omssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParsePath(t *testing.T) {
+	for _, testcase := range []struct {
+		s        string
+		expected Path
+	}{
+		{"i-aaaaaa:/var/log/syslog", Path{InstanceID: "i-aaaaaa", Path: "/var/log/syslog"}},
+		{"i-aaaaaa:", Path{InstanceID: "i-aaaaaa", Path: "."}},
+		{"./i-aaaaaa:hoge", Path{Path: "./i-aaaaaa:hoge"}},
+		{"/var/log/syslog", Path{Path: "/var/log/syslog"}},
+		{`C:\Users\hoge`, Path{Path: `C:\Users\hoge`}},
+	} {
+		actual := ParsePath(testcase.s)
+		if diff := cmp.Diff(testcase.expected, actual); diff != "" {
+			t.Errorf("wrong result: %s\n%s", testcase.s, diff)
+		}
+	}
+}
+
+func TestCopier(t *testing.T) {
+	mtime := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, testcase := range []struct {
+		name string
+		call func(t *testing.T, client *sftp.Client, local, remote string)
+	}{
+		{
+			"upload a file with permissions and modification time",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				src := filepath.Join(local, "app.conf")
+				writeFile(t, src, "hoge")
+				if err := os.Chmod(src, 0640); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(src, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+
+				var progress bytes.Buffer
+				c := &Copier{Preserve: true, Progress: &progress}
+				if err := c.Upload(client, []string{src}, remote); err != nil {
+					t.Fatal(err)
+				}
+
+				dst := filepath.Join(remote, "app.conf")
+				if diff := cmp.Diff("hoge", readFile(t, dst)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				info, err := os.Stat(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(os.FileMode(0640), info.Mode().Perm()); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				if !info.ModTime().Equal(mtime) {
+					t.Errorf("wrong result: \n%s", info.ModTime())
+				}
+				if !strings.Contains(progress.String(), "100%") {
+					t.Errorf("wrong result: \n%q", progress.String())
+				}
+			},
+		},
+		{
+			"download a file to a new name",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				writeFile(t, filepath.Join(remote, "syslog"), "hoge")
+
+				c := &Copier{}
+				dst := filepath.Join(local, "syslog.txt")
+				if err := c.Download(client, []string{filepath.Join(remote, "syslog")}, dst); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("hoge", readFile(t, dst)); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"download files matching glob",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				writeFile(t, filepath.Join(remote, "app.log"), "hoge")
+				writeFile(t, filepath.Join(remote, "app.log.1"), "moge")
+				writeFile(t, filepath.Join(remote, "error.log"), "fuga")
+
+				c := &Copier{}
+				if err := c.Download(client, []string{filepath.Join(remote, "app.log*")}, local); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("hoge", readFile(t, filepath.Join(local, "app.log"))); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				if diff := cmp.Diff("moge", readFile(t, filepath.Join(local, "app.log.1"))); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				if _, err := os.Stat(filepath.Join(local, "error.log")); !os.IsNotExist(err) {
+					t.Error("wrong result: \nerror.log is copied")
+				}
+			},
+		},
+		{
+			"upload a directory recursively",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				writeFile(t, filepath.Join(local, "conf", "app.conf"), "hoge")
+				writeFile(t, filepath.Join(local, "conf", "conf.d", "db.conf"), "moge")
+
+				c := &Copier{Recursive: true}
+				if err := c.Upload(client, []string{filepath.Join(local, "conf")}, remote); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("hoge", readFile(t, filepath.Join(remote, "conf", "app.conf"))); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+				if diff := cmp.Diff("moge", readFile(t, filepath.Join(remote, "conf", "conf.d", "db.conf"))); diff != "" {
+					t.Errorf("wrong result: \n%s", diff)
+				}
+			},
+		},
+		{
+			"directory without recursive",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				writeFile(t, filepath.Join(local, "conf", "app.conf"), "hoge")
+
+				c := &Copier{}
+				if err := c.Upload(client, []string{filepath.Join(local, "conf")}, remote); err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+			},
+		},
+		{
+			"many files to a file",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				writeFile(t, filepath.Join(local, "a.conf"), "hoge")
+				writeFile(t, filepath.Join(local, "b.conf"), "moge")
+
+				c := &Copier{}
+				if err := c.Upload(client, []string{filepath.Join(local, "*.conf")}, filepath.Join(remote, "c.conf")); err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+			},
+		},
+		{
+			"no such file",
+			func(t *testing.T, client *sftp.Client, local, remote string) {
+				c := &Copier{}
+				if err := c.Download(client, []string{filepath.Join(remote, "hoge")}, local); err == nil {
+					t.Error("wrong result: \nerr is nil")
+				}
+			},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			client, closeClient := newTestClient(t)
+			defer closeClient()
+			local, cleanupLocal := tempDir(t)
+			defer cleanupLocal()
+			remote, cleanupRemote := tempDir(t)
+			defer cleanupRemote()
+
+			testcase.call(t, client, local, remote)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	fuzzyfinder "github.com/ktr0731/go-fuzzyfinder"
@@ -75,6 +76,18 @@ func GetProfiles(credentialsPath string) (profiles []string, err error) {
 
 // FinderProfile : return profile selected in .aws/credentials
 func FinderProfile(profiles []string) (profile string, err error) {
+	selected, err := FinderProfiles(profiles)
+	if err != nil {
+		return profile, err
+	}
+	if len(selected) == 0 {
+		return profile, fuzzyfinder.ErrAbort
+	}
+	return selected[len(selected)-1], nil
+}
+
+// FinderProfiles : return profiles selected in .aws/credentials, several profiles can be selected by tab
+func FinderProfiles(profiles []string) (selected []string, err error) {
 	idx, err := fuzzyfinder.FindMulti(
 		profiles,
 		func(i int) string {
@@ -93,12 +106,14 @@ func FinderProfile(profiles []string) (profile string, err error) {
 	)
 
 	if err != nil {
-		return profile, err
+		return nil, err
 	}
 
+	// keep order of the list
+	sort.Ints(idx)
 	for _, i := range idx {
-		profile = profiles[i]
+		selected = append(selected, profiles[i])
 	}
 
-	return profile, nil
+	return selected, nil
 }
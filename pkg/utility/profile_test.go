@@ -101,3 +101,23 @@ func TestFinderProfile(t *testing.T) {
 		t.Run(testcase.name, testcase.call)
 	}
 }
+
+func TestFinderProfiles(t *testing.T) {
+	term := fuzzyfinder.UseMockedTerminal()
+	term.SetSize(60, 10)
+
+	term.SetEvents(
+		termbox.Event{Type: termbox.EventKey, Key: termbox.KeyTab},
+		termbox.Event{Type: termbox.EventKey, Key: termbox.KeyArrowUp},
+		termbox.Event{Type: termbox.EventKey, Key: termbox.KeyTab},
+		termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter},
+	)
+	profiles, err := FinderProfiles(testProfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// in order of the list
+	if diff := cmp.Diff([]string{"default", "hoge"}, profiles); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+}
@@ -0,0 +1,43 @@
+package omssh
+
+import "io"
+
+// Recorder : records the shell, e.g. *asciicast.Writer
+type Recorder interface {
+	Output(p []byte)
+	Input(p []byte)
+	Resize(width, height int)
+}
+
+// WithRecorder : record output, input and terminal resizes of the shell with r
+func WithRecorder(r Recorder) Option {
+	return func(d *SSHDevice) {
+		d.recorder = r
+	}
+}
+
+// recordingWriter : writer which records what is written
+type recordingWriter struct {
+	w      io.Writer
+	record func(p []byte)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.record(p[:n])
+	return n, err
+}
+
+// recordingReader : reader which records what is read
+type recordingReader struct {
+	r      io.Reader
+	record func(p []byte)
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.record(p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,58 @@
+package omssh
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testRecorder : recorder which keeps output and input
+type testRecorder struct {
+	mu     sync.Mutex
+	output bytes.Buffer
+	input  bytes.Buffer
+}
+
+func (r *testRecorder) Output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output.Write(p)
+}
+
+func (r *testRecorder) Input(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.input.Write(p)
+}
+
+func (r *testRecorder) Resize(width, height int) {}
+
+func TestRecorder(t *testing.T) {
+	recorder := &testRecorder{}
+	var stdout, stderr bytes.Buffer
+	device := connectTestSSHServer(t, WithStdio(strings.NewReader("~~ls\r"), &stdout, &stderr), WithRecorder(recorder))
+	defer func() {
+		// the shell has closed the session
+		_ = device.Close()
+	}()
+	device.SetupIO()
+
+	if err := device.StartShell(); err != nil {
+		t.Fatal(err)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if diff := cmp.Diff(stdout.String(), recorder.output.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	if diff := cmp.Diff("hello\r\n", recorder.output.String()); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+	// input may not have been read before the shell exits, and is recorded after escape sequences are taken
+	if !strings.HasPrefix("~ls\r", recorder.input.String()) {
+		t.Errorf("wrong result: \n%q", recorder.input.String())
+	}
+}
@@ -0,0 +1,210 @@
+package omssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// socks5 : protocol constants of RFC 1928
+const (
+	socksVersion = 0x05
+
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksIPv4   = 0x01
+	socksDomain = 0x03
+	socksIPv6   = 0x04
+
+	socksSucceeded           = 0x00
+	socksGeneralFailure      = 0x01
+	socksNotAllowed          = 0x02
+	socksConnectionRefused   = 0x05
+	socksCommandNotSupported = 0x07
+	socksAddressNotSupported = 0x08
+)
+
+// socksHandshakeTimeout : time for a client to send the socks request
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKSError : socks request rejected with a reply code
+type SOCKSError struct {
+	Reply byte
+	Msg   string
+}
+
+func (e *SOCKSError) Error() string {
+	return fmt.Sprintf("socks: %s", e.Msg)
+}
+
+// ParseDynamicForward : parse dynamic port forwarding specification "[bind_address:]port" of ssh -D
+func ParseDynamicForward(spec string) (Forward, error) {
+	f, err := splitForward(spec)
+	if err != nil {
+		return Forward{}, err
+	}
+
+	var bindHost, bindPort string
+	switch len(f) {
+	case 1:
+		bindHost, bindPort = "localhost", f[0]
+	case 2:
+		bindHost, bindPort = f[0], f[1]
+	default:
+		return Forward{}, fmt.Errorf("invalid forwarding %q: [bind_address:]port", spec)
+	}
+	if n, err := strconv.Atoi(bindPort); err != nil || n < 0 || n > 65535 {
+		return Forward{}, fmt.Errorf("invalid forwarding %q: bad port %q", spec, bindPort)
+	}
+
+	return Forward{BindAddress: net.JoinHostPort(bindHost, bindPort)}, nil
+}
+
+// DynamicForward : listen on BindAddress locally as a SOCKS5 proxy which connects to destinations from the remote
+func (d *SSHDevice) DynamicForward(f Forward) error {
+	l, err := net.Listen("tcp", f.BindAddress)
+	if err != nil {
+		return fmt.Errorf("dynamic forwarding %s: %v", f, err)
+	}
+	fw := &forwarder{
+		Forward:  f,
+		kind:     "dynamic",
+		listener: l,
+		dial:     d.client.Dial,
+	}
+	fw.connect = func(conn net.Conn) (net.Conn, error) {
+		return socksConnect(conn, fw.dial)
+	}
+	d.startForward(fw)
+	return nil
+}
+
+// socksConnect : read a SOCKS5 CONNECT request from conn, dial its destination and reply the result
+func socksConnect(conn net.Conn, dial func(network, address string) (net.Conn, error)) (net.Conn, error) {
+	if err := conn.SetDeadline(time.Now().Add(socksHandshakeTimeout)); err != nil {
+		return nil, err
+	}
+
+	address, err := readSOCKSRequest(conn)
+	if err != nil {
+		if e, ok := err.(*SOCKSError); ok {
+			_ = writeSOCKSReply(conn, e.Reply)
+		}
+		return nil, err
+	}
+
+	remote, err := dial("tcp", address)
+	if err != nil {
+		_ = writeSOCKSReply(conn, socksDialReply(err))
+		return nil, fmt.Errorf("socks: connect %s: %v", address, err)
+	}
+	if err := writeSOCKSReply(conn, socksSucceeded); err != nil {
+		_ = remote.Close()
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// readSOCKSRequest : negotiate no authentication and read the destination of CONNECT
+func readSOCKSRequest(r io.ReadWriter) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("socks: unsupported version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err := r.Write([]byte{socksVersion, method}); err != nil {
+		return "", err
+	}
+	if method == socksNoAcceptable {
+		return "", errors.New("socks: no acceptable authentication method")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(r, request); err != nil {
+		return "", err
+	}
+	if request[0] != socksVersion {
+		return "", fmt.Errorf("socks: unsupported version %d", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(r, n); err != nil {
+			return "", err
+		}
+		domain := make([]byte, n[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", &SOCKSError{Reply: socksAddressNotSupported, Msg: fmt.Sprintf("unsupported address type %d", request[3])}
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+
+	if request[1] != socksCmdConnect {
+		return "", &SOCKSError{Reply: socksCommandNotSupported, Msg: fmt.Sprintf("unsupported command %d", request[1])}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSOCKSReply : reply without bound address, which is on the remote and unknown
+func writeSOCKSReply(w io.Writer, reply byte) error {
+	_, err := w.Write([]byte{socksVersion, reply, 0x00, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksDialReply : reply code of failure to open a channel on the remote
+func socksDialReply(err error) byte {
+	if e, ok := err.(*ssh.OpenChannelError); ok {
+		switch e.Reason {
+		case ssh.Prohibited:
+			return socksNotAllowed
+		case ssh.ConnectionFailed:
+			return socksConnectionRefused
+		}
+	}
+	return socksGeneralFailure
+}
@@ -0,0 +1,164 @@
+package omssh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDynamicForward(t *testing.T) {
+	for _, testcase := range []struct {
+		spec     string
+		expected Forward
+	}{
+		{"1080", Forward{BindAddress: "localhost:1080"}},
+		{"0.0.0.0:1080", Forward{BindAddress: "0.0.0.0:1080"}},
+		{"[::1]:1080", Forward{BindAddress: "[::1]:1080"}},
+	} {
+		actual, err := ParseDynamicForward(testcase.spec)
+		if err != nil {
+			t.Error(err)
+		}
+		if diff := cmp.Diff(testcase.expected, actual); diff != "" {
+			t.Errorf("wrong result: %s\n%s", testcase.spec, diff)
+		}
+	}
+
+	for _, spec := range []string{"", "hoge", "70000", "localhost:1080:hoge"} {
+		if _, err := ParseDynamicForward(spec); err == nil {
+			t.Errorf("wrong result: %q\nerr is nil", spec)
+		}
+	}
+}
+
+// socksRequest : send a socks5 request of the command to the address, return the reply code
+func socksRequest(t *testing.T, proxy string, cmd, atyp byte, addr []byte, port int) (net.Conn, byte) {
+	conn, err := net.Dial("tcp", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Write([]byte{socksVersion, 1, socksNoAuth}); err != nil {
+		t.Fatal(err)
+	}
+	method := make([]byte, 2)
+	if _, err := io.ReadFull(conn, method); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte{socksVersion, socksNoAuth}, method); diff != "" {
+		t.Fatalf("wrong result: \n%s", diff)
+	}
+
+	request := append([]byte{socksVersion, cmd, 0x00, atyp}, addr...)
+	request = append(request, 0, 0)
+	binary.BigEndian.PutUint16(request[len(request)-2:], uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	return conn, reply[1]
+}
+
+func TestDynamicForward(t *testing.T) {
+	echoListener := echoServer(t)
+	defer func() {
+		if err := echoListener.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	echoPort := echoListener.Addr().(*net.TCPAddr).Port
+
+	device := connectTestSSHServer(t)
+	defer func() {
+		if err := device.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	proxy := net.JoinHostPort("127.0.0.1", availablePort())
+	if err := device.DynamicForward(Forward{BindAddress: proxy}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testcase := range []struct {
+		name     string
+		cmd      byte
+		atyp     byte
+		addr     []byte
+		port     int
+		expected byte
+	}{
+		{"ipv4", socksCmdConnect, socksIPv4, net.ParseIP("127.0.0.1").To4(), echoPort, socksSucceeded},
+		{"domain", socksCmdConnect, socksDomain, append([]byte{9}, "127.0.0.1"...), echoPort, socksSucceeded},
+		{"bind is not supported", 0x02, socksIPv4, net.ParseIP("127.0.0.1").To4(), echoPort, socksCommandNotSupported},
+		{"unknown address type", socksCmdConnect, 0x05, nil, echoPort, socksAddressNotSupported},
+		{"connection refused", socksCmdConnect, socksIPv4, net.ParseIP("127.0.0.1").To4(), mustAtoi(t, availablePort()), socksConnectionRefused},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			conn, reply := socksRequest(t, proxy, testcase.cmd, testcase.atyp, testcase.addr, testcase.port)
+			defer func() {
+				_ = conn.Close()
+			}()
+			if diff := cmp.Diff(testcase.expected, reply); diff != "" {
+				t.Fatalf("wrong result: \n%s", diff)
+			}
+			if reply != socksSucceeded {
+				return
+			}
+
+			if _, err := fmt.Fprintln(conn, "hoge"); err != nil {
+				t.Fatal(err)
+			}
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff("hoge\n", line); diff != "" {
+				t.Errorf("wrong result: \n%s", diff)
+			}
+		})
+	}
+
+	t.Run("ipv6", func(t *testing.T) {
+		l, err := net.Listen("tcp", "[::1]:0")
+		if err != nil {
+			t.Skip("ipv6 is not available")
+		}
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = io.Copy(conn, conn)
+			_ = conn.Close()
+		}()
+		defer func() {
+			_ = l.Close()
+		}()
+
+		conn, reply := socksRequest(t, proxy, socksCmdConnect, socksIPv6, net.ParseIP("::1"), l.Addr().(*net.TCPAddr).Port)
+		defer func() {
+			_ = conn.Close()
+		}()
+		if diff := cmp.Diff(byte(socksSucceeded), reply); diff != "" {
+			t.Errorf("wrong result: \n%s", diff)
+		}
+	})
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+package omssh
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	defaultTerminalWidth  = 80
+	defaultTerminalHeight = 25
+)
+
+// fd : return file descriptor of stdio, -1 if it is not a file
+func fd(v interface{}) int {
+	if f, ok := v.(*os.File); ok && f != nil {
+		return int(f.Fd())
+	}
+	return -1
+}
+
+// terminalSize : return size of the local terminal, 80x25 if it is not a terminal
+func terminalSize(fd int) (width, height int) {
+	if !terminal.IsTerminal(fd) {
+		return defaultTerminalWidth, defaultTerminalHeight
+	}
+	width, height, err := terminal.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		return defaultTerminalWidth, defaultTerminalHeight
+	}
+	return width, height
+}
+
+// rawTerminal : local terminal which can be restored and put into raw mode again, e.g. on suspend
+type rawTerminal struct {
+	fd    int
+	mu    sync.Mutex
+	state *terminal.State
+}
+
+// makeRaw : put the terminal into raw mode, nothing is done if it is not a terminal
+func (t *rawTerminal) makeRaw() error {
+	if !terminal.IsTerminal(t.fd) {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state != nil {
+		return nil
+	}
+	state, err := terminal.MakeRaw(t.fd)
+	if err != nil {
+		return err
+	}
+	t.state = state
+	return nil
+}
+
+// restore : restore the terminal from raw mode
+func (t *rawTerminal) restore() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == nil {
+		return
+	}
+	// nothing left to do if the terminal has gone
+	_ = terminal.Restore(t.fd, t.state)
+	t.state = nil
+}
+
+// onTermination : call terminate once when the process is asked to terminate by a signal until stop is called,
+// e.g. kill from another shell, as keys do not send signals in raw mode
+func onTermination(terminate func()) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, terminationSignals...)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sig:
+			terminate()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
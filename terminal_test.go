@@ -0,0 +1,38 @@
+package omssh
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTerminalSizeNotTerminal(t *testing.T) {
+	f, err := ioutil.TempFile("", "omssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := os.Remove(f.Name()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	width, height := terminalSize(int(f.Fd()))
+	if diff := cmp.Diff([]int{80, 25}, []int{width, height}); diff != "" {
+		t.Errorf("wrong result: \n%s", diff)
+	}
+
+	raw := &rawTerminal{fd: int(f.Fd())}
+	if err := raw.makeRaw(); err != nil {
+		t.Error(err)
+	}
+	if raw.state != nil {
+		t.Error("wrong result: \nfile is put into raw mode")
+	}
+	raw.restore()
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package omssh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ttyPath : terminal of the process, which is read even if stdin is redirected
+const ttyPath = "/dev/tty"
+
+var terminationSignals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM}
+
+// watchTerminalSize : call resize on SIGWINCH until stop is called
+func watchTerminalSize(fd int, resize func(width, height int)) (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sig:
+				resize(terminalSize(fd))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+// suspend : stop the process like Ctrl-Z until it is continued by the shell
+func suspend() error {
+	return syscall.Kill(os.Getpid(), syscall.SIGTSTP)
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package omssh
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOnTermination(t *testing.T) {
+	for _, sig := range []syscall.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM} {
+		t.Run(sig.String(), func(t *testing.T) {
+			terminated := make(chan struct{})
+			stop := onTermination(func() {
+				close(terminated)
+			})
+			defer stop()
+
+			// e.g. kill -INT from another shell
+			if err := syscall.Kill(os.Getpid(), sig); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-terminated:
+			case <-time.After(5 * time.Second):
+				t.Fatal("wrong result: \nterminate is not called")
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package omssh
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ttyPath : console input of the process, which is read even if stdin is redirected
+const ttyPath = "CONIN$"
+
+var terminationSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// watchTerminalSize : poll the console size and call resize on change until stop is called,
+// as windows has no SIGWINCH
+func watchTerminalSize(fd int, resize func(width, height int)) (stop func()) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		width, height := terminalSize(fd)
+		for {
+			select {
+			case <-ticker.C:
+				w, h := terminalSize(fd)
+				if w != width || h != height {
+					width, height = w, h
+					resize(w, h)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// suspend : windows has no job control to suspend the process
+func suspend() error {
+	return errors.New("suspend is not supported on windows")
+}